@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/wiki"
+)
+
+// indexAliases adds the words of every redirect's title to the builder as
+// alias postings of the page it points at, returning how many redirects
+// resolved to an indexed page.
+func indexAliases(savePath string, docs *index.DocTable, builder *index.Builder) (int, error) {
+	redirects, err := index.LoadRedirects(filepath.Join(savePath, constants.RedirectTableFolder))
+	if err != nil {
+		return 0, err
+	}
+	targets := make(map[string]struct{}, len(redirects))
+	for from := range redirects {
+		targets[index.ResolveRedirect(redirects, from)] = struct{}{}
+	}
+	titleDocs := make(map[string]uint32, len(targets))
+	for docID := range uint32(docs.Len()) {
+		doc, err := docs.Get(docID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get doc: %w", err)
+		}
+		if docs.Superseded(docID) {
+			continue
+		}
+		title := index.NormalizeTitle(doc.Title)
+		if _, ok := targets[title]; ok {
+			titleDocs[title] = docID
+		}
+	}
+
+	aliases := map[uint32]map[string]int{}
+	resolved := 0
+	for from := range redirects {
+		docID, ok := titleDocs[index.ResolveRedirect(redirects, from)]
+		if !ok {
+			continue
+		}
+		wordFreqs, err := wiki.GatherWordFrequency(strings.NewReader(from))
+		if err != nil {
+			return 0, fmt.Errorf("failed to gather words of %s: %w", from, err)
+		}
+		if aliases[docID] == nil {
+			aliases[docID] = map[string]int{}
+		}
+		for word, freq := range wordFreqs {
+			aliases[docID][word] += freq
+		}
+		resolved++
+	}
+
+	docIDs := make([]uint32, 0, len(aliases))
+	for docID := range aliases {
+		docIDs = append(docIDs, docID)
+	}
+	slices.Sort(docIDs)
+	for _, docID := range docIDs {
+		builder.AddAliases(docID, aliases[docID])
+	}
+	return resolved, nil
+}
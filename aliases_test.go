@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+)
+
+func TestIndexAliases(t *testing.T) {
+	savePath := t.TempDir()
+	docs := writeTestTables(t, savePath,
+		[]index.Doc{
+			{Title: "United States", PageID: 1, RevisionID: 10},
+			{Title: "Plant", PageID: 2, RevisionID: 20},
+			{Title: "United States", PageID: 1, RevisionID: 11},
+		},
+		nil,
+		[]index.Redirect{
+			{From: "USA", To: "United States"},
+			{From: "United States of America", To: "USA"},
+			{From: "Green plants", To: "Plant"},
+			{From: "Unicorn", To: "Unicorns"}, // to a page that was never indexed
+		},
+	)
+	builder := index.NewBuilder()
+	n, err := indexAliases(savePath, docs, builder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("%d redirects resolved, want 3", n)
+	}
+	segmentDir, indexDir := filepath.Join(savePath, constants.SegmentFileFolder), filepath.Join(savePath, constants.IndexFileFolder)
+	if err := builder.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.Merge(segmentDir, indexDir, docs.Superseded); err != nil {
+		t.Fatal(err)
+	}
+
+	// the aliases go to the latest doc of the page, words of every redirect
+	// to it counted together
+	for term, want := range map[string][]index.Posting{
+		"usa":     {{DocID: 2, Freq: 1}},
+		"united":  {{DocID: 2, Freq: 1}},
+		"america": {{DocID: 2, Freq: 1}},
+		"green":   {{DocID: 1, Freq: 1}},
+		"unicorn": nil,
+	} {
+		var got []index.Posting
+		path, err := index.TermPath(indexDir, term)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pf, err := index.ReadPostingFile(path); err == nil {
+			if got, err = pf.Postings(index.FieldAlias); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s aliases = %v, want %v", term, got, want)
+		}
+	}
+}
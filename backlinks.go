@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/normalize"
+)
+
+// indexBacklinks inverts the link table into the backlinks index, following
+// links to redirects through to the page they end at and leaving out the links
+// of superseded docs. It returns how many distinct pages are linked to.
+func indexBacklinks(savePath string, docs *index.DocTable) (int, error) {
+	redirects, err := index.LoadRedirects(filepath.Join(savePath, constants.RedirectTableFolder))
+	if err != nil {
+		return 0, err
+	}
+	backlinks := map[string][]uint32{}
+	err = index.ReadLinks(filepath.Join(savePath, constants.LinkTableFolder), func(l index.PageLinks) error {
+		if docs.Superseded(l.DocID) {
+			return nil
+		}
+		for _, to := range l.To {
+			slug := normalize.Slug(index.ResolveRedirect(redirects, to))
+			backlinks[slug] = append(backlinks[slug], l.DocID)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := index.WriteSlugIndex(filepath.Join(savePath, constants.BacklinkFolder), index.BacklinkIndex, backlinks); err != nil {
+		return 0, err
+	}
+	return len(backlinks), nil
+}
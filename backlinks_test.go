@@ -0,0 +1,99 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+)
+
+// writeTestTables writes the docs, links and redirects of a small index to
+// savePath, returning its doc table.
+func writeTestTables(t *testing.T, savePath string, docs []index.Doc, links []index.PageLinks, redirects []index.Redirect) *index.DocTable {
+	t.Helper()
+	dt, err := index.OpenDocTable(filepath.Join(savePath, constants.DocTableFolder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = dt.Close() })
+	for _, doc := range docs {
+		if _, err := dt.Append(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lt, err := index.OpenLinkTable(filepath.Join(savePath, constants.LinkTableFolder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range links {
+		if err := lt.Append(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rt, err := index.OpenRedirectTable(filepath.Join(savePath, constants.RedirectTableFolder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range redirects {
+		if err := rt.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return dt
+}
+
+func TestIndexBacklinks(t *testing.T) {
+	savePath := t.TempDir()
+	docs := writeTestTables(t, savePath,
+		[]index.Doc{
+			{Title: "Plant", PageID: 1, RevisionID: 10},
+			{Title: "Leaf", PageID: 2, RevisionID: 20},
+			{Title: "Tree", PageID: 3, RevisionID: 30},
+			{Title: "Leaf", PageID: 2, RevisionID: 21}, // Leaf edited, no longer linking to Tree
+		},
+		[]index.PageLinks{
+			{DocID: 0, To: []string{"leaf"}},
+			{DocID: 1, To: []string{"green_plants", "Tree"}},
+			{DocID: 2, To: []string{"Green plants", "flora"}},
+			{DocID: 3, To: []string{"Plant"}},
+		},
+		[]index.Redirect{
+			{From: "Green plants", To: "Plant"},
+			{From: "Flora", To: "Green plants"},
+		},
+	)
+	n, err := indexBacklinks(savePath, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("%d pages linked to, want 2", n)
+	}
+	si, err := index.OpenSlugIndex(filepath.Join(savePath, constants.BacklinkFolder), index.BacklinkIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = si.Close() }()
+	for slug, want := range map[string][]uint32{
+		"plant": {2, 3}, // through redirects, however the link was written
+		"leaf":  {0},
+		"tree":  nil,
+	} {
+		got, err := si.Get(slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("backlinks of %s = %v, want %v", slug, got, want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/normalize"
+)
+
+// indexCategories gathers the categories in the link table into the category
+// members index, leaving out superseded docs, and returns how many categories
+// have members.
+func indexCategories(savePath string, docs *index.DocTable) (int, error) {
+	members := map[string][]uint32{}
+	err := index.ReadLinks(filepath.Join(savePath, constants.LinkTableFolder), func(l index.PageLinks) error {
+		if docs.Superseded(l.DocID) {
+			return nil
+		}
+		for _, category := range l.Categories {
+			slug := normalize.Slug(category)
+			members[slug] = append(members[slug], l.DocID)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := index.WriteSlugIndex(filepath.Join(savePath, constants.CategoryFolder), index.CategoryIndex, members); err != nil {
+		return 0, err
+	}
+	return len(members), nil
+}
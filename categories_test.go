@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+)
+
+func TestIndexCategories(t *testing.T) {
+	savePath := t.TempDir()
+	docs := writeTestTables(t, savePath,
+		[]index.Doc{
+			{Title: "Fern", PageID: 1, RevisionID: 10},
+			{Title: "Moss", PageID: 2, RevisionID: 20},
+			{Title: "Rose", PageID: 3, RevisionID: 30},
+			{Title: "Fern", PageID: 1, RevisionID: 11}, // Fern edited, no longer a flowering plant
+		},
+		[]index.PageLinks{
+			{DocID: 0, Categories: []string{"Plants", "Flowering plants"}},
+			{DocID: 1, To: []string{"Fern"}, Categories: []string{"plants"}},
+			{DocID: 2, Categories: []string{"Flowering_plants", "Plants"}},
+			{DocID: 3, Categories: []string{"Plants"}},
+		},
+		nil,
+	)
+	n, err := indexCategories(savePath, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("%d categories with members, want 2", n)
+	}
+	si, err := index.OpenSlugIndex(filepath.Join(savePath, constants.CategoryFolder), index.CategoryIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = si.Close() }()
+	for slug, want := range map[string][]uint32{
+		"plants":           {1, 2, 3}, // however the category was written
+		"flowering-plants": {2},
+		"trees":            nil,
+	} {
+		got, err := si.Get(slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("members of %s = %v, want %v", slug, got, want)
+		}
+	}
+}
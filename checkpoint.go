@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const checkpointFileName = "checkpoint.json"
+
+// checkpoint records how far ingestion got. It is only written once every
+// page up to LastPageID has been saved and indexed.
+type checkpoint struct {
+	DumpFile   string `json:"dump_file"`
+	LastPageID int64  `json:"last_page_id"`
+	// StreamOffset is the offset of the next multistream stream to read, or -1
+	// when the dump is being read sequentially.
+	StreamOffset int64 `json:"stream_offset"`
+	// NumDocs is the size of the doc table, anything past it was added after
+	// the checkpoint and is rolled back when resuming.
+	NumDocs int `json:"num_docs"`
+	// RedirectBytes is the size of the redirect table, rolled back like
+	// NumDocs.
+	RedirectBytes int64 `json:"redirect_bytes"`
+	// LinkBytes is the size of the link table, rolled back like NumDocs.
+	LinkBytes int64 `json:"link_bytes"`
+	// Segments is the number of segments flushed and not yet merged, any
+	// flushed after the checkpoint hold postings of docs rolled back.
+	Segments int `json:"segments"`
+	// AliasesIndexed is set once the whole dump is ingested and the redirect
+	// titles have been indexed as aliases of their targets.
+	AliasesIndexed bool `json:"aliases_indexed"`
+	// BacklinksIndexed is set once the link table has been inverted into the
+	// backlinks index.
+	BacklinksIndexed bool `json:"backlinks_indexed"`
+	// CategoriesIndexed is set once the categories in the link table have
+	// been gathered into the category members index.
+	CategoriesIndexed bool      `json:"categories_indexed"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+func loadCheckpoint(savePath string) (checkpoint, error) {
+	b, err := os.ReadFile(filepath.Join(savePath, checkpointFileName))
+	if err != nil {
+		return checkpoint{}, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return checkpoint{}, fmt.Errorf("failed to unmarshal checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+// saveCheckpoint writes the checkpoint to a temp file and renames it into
+// place, so a crash leaves either the old or the new checkpoint, never half.
+func saveCheckpoint(savePath string, cp checkpoint) error {
+	cp.UpdatedAt = time.Now().UTC()
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	if err := os.MkdirAll(savePath, 0755); err != nil {
+		return fmt.Errorf("failed to create save path: %w", err)
+	}
+	fh, err := os.CreateTemp(savePath, checkpointFileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp checkpoint: %w", err)
+	}
+	tmpPath := fh.Name()
+	_, err = fh.Write(b)
+	if err == nil {
+		err = fh.Sync()
+	}
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to write temp checkpoint: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(savePath, checkpointFileName)); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename checkpoint: %w", err)
+	}
+	return nil
+}
+
+// resumeCheckpoint loads the checkpoint for dumpFile, a missing checkpoint
+// means starting from the beginning.
+func resumeCheckpoint(savePath, dumpFile string) (checkpoint, error) {
+	cp, err := loadCheckpoint(savePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint{DumpFile: dumpFile, StreamOffset: -1}, nil
+	}
+	if err != nil {
+		return checkpoint{}, err
+	}
+	if cp.DumpFile != dumpFile {
+		return checkpoint{}, fmt.Errorf("checkpoint is for dump %s, not %s", cp.DumpFile, dumpFile)
+	}
+	return cp, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "index") // created when first saved
+	want := checkpoint{
+		DumpFile:       "enwiki-20241001-pages-articles-multistream.xml.bz2",
+		LastPageID:     1234,
+		StreamOffset:   5678,
+		NumDocs:        99,
+		RedirectBytes:  1000,
+		LinkBytes:      2000,
+		Segments:       3,
+		AliasesIndexed: true,
+	}
+	if err := saveCheckpoint(savePath, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadCheckpoint(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(got.UpdatedAt) > time.Minute {
+		t.Errorf("UpdatedAt = %s, want about now", got.UpdatedAt)
+	}
+	got.UpdatedAt = time.Time{}
+	if got != want {
+		t.Errorf("loaded checkpoint = %+v, want %+v", got, want)
+	}
+
+	// saving again replaces it, leaving no temp files behind
+	want.LastPageID = 2000
+	if err := saveCheckpoint(savePath, want); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = loadCheckpoint(savePath); err != nil || got.LastPageID != 2000 {
+		t.Errorf("loaded checkpoint = %+v, %v, want LastPageID 2000", got, err)
+	}
+	entries, err := os.ReadDir(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != checkpointFileName {
+		t.Errorf("save path has %v, want only %s", entries, checkpointFileName)
+	}
+}
+
+func TestResumeCheckpoint(t *testing.T) {
+	const dump = "enwiki-20241001-pages-articles-multistream.xml.bz2"
+	savePath := t.TempDir()
+	cp, err := resumeCheckpoint(savePath, dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp != (checkpoint{DumpFile: dump, StreamOffset: -1}) {
+		t.Errorf("checkpoint without a checkpoint file = %+v, want to start from the beginning", cp)
+	}
+
+	if err := saveCheckpoint(savePath, checkpoint{DumpFile: dump, LastPageID: 10, StreamOffset: 300}); err != nil {
+		t.Fatal(err)
+	}
+	if cp, err = resumeCheckpoint(savePath, dump); err != nil || cp.LastPageID != 10 || cp.StreamOffset != 300 {
+		t.Errorf("resumed checkpoint = %+v, %v", cp, err)
+	}
+	if _, err := resumeCheckpoint(savePath, "enwiki-20241101-pages-articles-multistream.xml.bz2"); err == nil {
+		t.Error("resumed the checkpoint of another dump")
+	}
+
+	if err := os.WriteFile(filepath.Join(savePath, checkpointFileName), []byte(`{"dump_file": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resumeCheckpoint(savePath, dump); err == nil {
+		t.Error("resumed a corrupt checkpoint")
+	}
+}
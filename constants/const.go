@@ -2,3 +2,13 @@ package constants
 
 const PageFileFolder = "pages"
 const IndexFileFolder = "index"
+const SegmentFileFolder = "segments"
+const DocTableFolder = "docs"
+const RedirectTableFolder = "redirects"
+const LinkTableFolder = "links"
+const BacklinkFolder = "backlinks"
+const PriorFolder = "priors"
+const CategoryFolder = "categories"
+
+// InfoboxFileSuffix replaces a page file's .xml for the JSON of its infobox.
+const InfoboxFileSuffix = ".infobox.json"
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// defaultAPILimit is how many results /api/search returns without a limit.
+const defaultAPILimit = 20
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("Failed to write JSON response: %v\n", err)
+	}
+}
+
+// handleAPISearch is the JSON version of /search, taking the same parameters
+// along with limit and offset.
+func handleAPISearch(e *engine, cache *resultCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, err := parseSearchRequest(e, r, defaultAPILimit)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		resp, _, err := cachedSearch(e, cache, req)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to search"})
+			fmt.Printf("Failed to search: %v\n", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// handleCacheStats reports the search results cache's size and hit rate.
+func handleCacheStats(cache *resultCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, cache.stats())
+	}
+}
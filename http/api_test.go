@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+var apiPages = []testPage{
+	{title: "Plant", text: "Plants are eukaryotes that photosynthesize."},
+	{title: "Fern", text: "A fern is a plant without flowers."},
+	{title: "Rock", text: "A rock is not alive."},
+}
+
+// getJSON serves the request with h and decodes the JSON response into v.
+func getJSON(t *testing.T, h http.Handler, target string, v any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s Content-Type = %q, want application/json", target, ct)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("failed to decode %s response %q: %v", target, rec.Body, err)
+	}
+	return rec.Code
+}
+
+func TestAPISearch(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: apiPages})
+	cache := newResultCache(10, 1<<20, time.Minute)
+	defer cache.close()
+	h := handleAPISearch(e, cache)
+
+	var resp struct {
+		Query     string  `json:"query"`
+		TookMS    float64 `json:"took_ms"`
+		Cached    bool    `json:"cached"`
+		TotalHits int     `json:"total_hits"`
+		Offset    int     `json:"offset"`
+		Limit     int     `json:"limit"`
+		Results   []struct {
+			Title     string           `json:"title"`
+			URL       string           `json:"url"`
+			Snippet   string           `json:"snippet"`
+			Score     float64          `json:"score"`
+			Breakdown []ScoreComponent `json:"breakdown"`
+		} `json:"results"`
+	}
+	if code := getJSON(t, h, "/api/search?q=plant", &resp); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if resp.Query != "plant" || resp.Cached || resp.TotalHits != 2 || resp.Limit != defaultAPILimit || len(resp.Results) != 2 {
+		t.Fatalf("response = %+v", resp)
+	}
+	first := resp.Results[0]
+	if first.Title != "Plant" || first.URL != "/page/"+pageRelPath("plant") || first.Snippet != apiPages[0].text ||
+		first.Score <= resp.Results[1].Score || len(first.Breakdown) == 0 {
+		t.Errorf("first result = %+v", first)
+	}
+
+	// the same search again comes from the cache
+	resp.Cached = false
+	getJSON(t, h, "/api/search?q=Plant+", &resp)
+	if !resp.Cached {
+		t.Error("cached response isn't flagged as cached")
+	}
+	if st := cache.stats(); st.Hits != 1 || st.Misses != 1 {
+		t.Errorf("cache stats = %+v, want a hit and a miss", st)
+	}
+	var st cacheStats
+	if code := getJSON(t, handleCacheStats(cache), "/api/cache", &st); code != http.StatusOK || st.Entries != 1 {
+		t.Errorf("/api/cache = %d, %+v", code, st)
+	}
+}
+
+func TestAPISearchBadRequests(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: apiPages})
+	cache := newResultCache(10, 1<<20, time.Minute)
+	defer cache.close()
+	h := handleAPISearch(e, cache)
+	for _, params := range []url.Values{
+		{},
+		{"q": {"  "}},
+		{"q": {"plant"}, "rank": {"random"}},
+		{"q": {"plant"}, "stem": {"maybe"}},
+		{"q": {"plant"}, "offset": {"-1"}},
+		{"q": {"plant"}, "limit": {"0"}},
+		{"q": {"plant"}, "limit": {"101"}},
+		{"q": {"(plant"}},
+		{"q": {"plant ns:nowhere"}},
+	} {
+		var resp apiError
+		code := getJSON(t, h, "/api/search?"+params.Encode(), &resp)
+		if code != http.StatusBadRequest || resp.Error == "" {
+			t.Errorf("%s: status %d, error %q, want 400 with an error", params.Encode(), code, resp.Error)
+		}
+	}
+}
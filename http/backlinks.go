@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/samiam2013/wiki4dummies/normalize"
+)
+
+// handleBacklinks lists the pages linking to the page with the slug, or to
+// the page a redirect's slug points at.
+func handleBacklinks(e *engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := r.PathValue("slug")
+		if target, ok := e.redirectSlugs[slug]; ok {
+			slug = normalize.Slug(target)
+		}
+		offset, limit, err := parseListWindow(r, listPageSize)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		docIDs, err := e.backlinks.Get(slug)
+		if err != nil {
+			http.Error(w, "Failed to look up backlinks", http.StatusInternalServerError)
+			fmt.Printf("Failed to look up backlinks: %v\n", err)
+			return
+		}
+		title := "Pages that link to " + slug
+		if page, err := e.readPage(pageRelPath(slug)); err == nil {
+			title = "Pages that link to " + page.Title
+		}
+		writePageList(e, w, r, PageListData{Title: title, Heading: title}, docIDs, offset, limit)
+	}
+}
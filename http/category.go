@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/samiam2013/wiki4dummies/normalize"
+)
+
+// CategoryResponse is a window of a category's members.
+type CategoryResponse struct {
+	Category string    `json:"category"`
+	Total    int       `json:"total"`
+	Offset   int       `json:"offset"`
+	Limit    int       `json:"limit"`
+	Pages    []PageRef `json:"pages"`
+}
+
+// categoryName is how a category named in a URL, like Flowering_plants, is
+// shown.
+func categoryName(name string) string {
+	return strings.ReplaceAll(name, "_", " ")
+}
+
+// handleCategory lists the pages in the category, in the order they were
+// indexed.
+func handleCategory(e *engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := categoryName(r.PathValue("name"))
+		offset, limit, err := parseListWindow(r, listPageSize)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		docIDs, err := e.categories.Get(normalize.Slug(name))
+		if err != nil {
+			http.Error(w, "Failed to look up category", http.StatusInternalServerError)
+			fmt.Printf("Failed to look up category: %v\n", err)
+			return
+		}
+		if len(docIDs) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		data := PageListData{Title: "Category: " + name, Heading: "Pages in category \"" + name + "\""}
+		writePageList(e, w, r, data, docIDs, offset, limit)
+	}
+}
+
+// handleAPICategory is the JSON version of /category/{name}, taking limit
+// and offset.
+func handleAPICategory(e *engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := categoryName(r.PathValue("name"))
+		offset, limit, err := parseListWindow(r, defaultAPILimit)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		docIDs, err := e.categories.Get(normalize.Slug(name))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to look up category"})
+			fmt.Printf("Failed to look up category: %v\n", err)
+			return
+		}
+		if len(docIDs) == 0 {
+			writeJSON(w, http.StatusNotFound, apiError{Error: "no such category"})
+			return
+		}
+		pages, err := e.pageRefs(docIDs, offset, limit)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to list pages"})
+			fmt.Printf("Failed to list pages: %v\n", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, CategoryResponse{
+			Category: name,
+			Total:    len(docIDs),
+			Offset:   offset,
+			Limit:    limit,
+			Pages:    pages,
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var categoryPages = []testPage{
+	{title: "Fern", text: "A fern has fronds and spores.", categories: []string{"Plants"}},
+	{title: "Rose", text: "A rose has thorns and petals.", categories: []string{"Plants", "Flowering plants"}},
+	{title: "Tulip", text: "A tulip has petals and grows from a bulb.", categories: []string{"Flowering_plants"}},
+	{title: "Granite", text: "Granite is a rock, not a plant."},
+}
+
+func TestCategorySearch(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: categoryPages})
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"incategory:plants", []string{"Fern", "Rose"}},
+		{"incategory:Flowering_plants", []string{"Rose", "Tulip"}},
+		{`incategory:"flowering plants" petals`, []string{"Rose", "Tulip"}},
+		{"incategory:plants petals", []string{"Rose"}},
+		{"petals -incategory:plants", []string{"Tulip"}},
+		{"incategory:rocks", nil},
+	}
+	for _, tt := range tests {
+		got := searchTitles(t, e, tt.q)
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s results = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestCategoryPages(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: categoryPages})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/category/{name}", handleCategory(e))
+	mux.HandleFunc("/api/category/{name}", handleAPICategory(e))
+
+	var resp CategoryResponse
+	if code := getJSON(t, mux, "/api/category/Flowering_plants?limit=1&offset=1", &resp); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if resp.Category != "Flowering plants" || resp.Total != 2 || resp.Offset != 1 || resp.Limit != 1 ||
+		len(resp.Pages) != 1 || resp.Pages[0].Title != "Tulip" || resp.Pages[0].URL != "/page/"+pageRelPath("tulip") {
+		t.Errorf("response = %+v", resp)
+	}
+	var apiErr apiError
+	if code := getJSON(t, mux, "/api/category/Rocks", &apiErr); code != http.StatusNotFound {
+		t.Errorf("unknown category status = %d, want 404", code)
+	}
+	if code := getJSON(t, mux, "/api/category/Plants?limit=0", &apiErr); code != http.StatusBadRequest {
+		t.Errorf("limit=0 status = %d, want 400", code)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/category/Plants", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Fern") || !strings.Contains(rec.Body.String(), "Rose") {
+		t.Errorf("category page = %d %q, want Fern and Rose listed", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/category/Rocks", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown category page status = %d, want 404", rec.Code)
+	}
+}
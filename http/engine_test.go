@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/normalize"
+	"github.com/samiam2013/wiki4dummies/wiki"
+)
+
+// testPage is an article indexed the way the indexer would, doc IDs are given
+// in order.
+type testPage struct {
+	title      string
+	text       string
+	ns         int      // the namespace's key, 0 for articles
+	pageID     int64    // set for a later revision of an earlier page
+	aliases    []string // the titles of redirects to the page
+	categories []string
+	infobox    string // the infobox template's wikitext
+}
+
+// testIndex is what newTestEngine indexes.
+type testIndex struct {
+	pages     []testPage
+	positions bool // like -positions
+}
+
+// newTestEngine indexes the pages into a temp save path and loads it the way
+// the server does, with the default BM25 settings.
+func newTestEngine(t *testing.T, ti testIndex) *engine {
+	t.Helper()
+	savePath := t.TempDir()
+	manifest := index.Manifest{
+		Build:  index.CurrentBuild(),
+		DBName: "testwiki",
+		Namespaces: []index.Namespace{
+			{Key: 0},
+			{Key: 1, Name: "Talk"},
+			{Key: 4, Name: "Wikipedia"},
+			{Key: 14, Name: "Category"},
+		},
+	}
+	if err := index.WriteManifest(savePath, manifest); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := index.OpenDocTable(filepath.Join(savePath, constants.DocTableFolder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = docs.Close() })
+
+	builder := index.NewBuilder()
+	redirects := map[string]string{}
+	members := map[string][]uint32{}
+	for i, p := range ti.pages {
+		wordFreqs := gatherWords(t, p.text)
+		pageID := p.pageID
+		if pageID == 0 {
+			pageID = int64(i + 1)
+		}
+		doc := index.Doc{
+			Title:      p.title,
+			PageID:     pageID,
+			RevisionID: int64(i + 1),
+			Abstract:   p.text,
+			RelPath:    pageRelPath(normalize.Slug(p.title)),
+			Namespace:  p.ns,
+		}
+		for _, freq := range wordFreqs {
+			doc.TokenCount += freq
+		}
+		docID, err := docs.Append(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var positions map[string][]uint32
+		if ti.positions {
+			positions = wiki.WordPositions(p.text)
+		}
+		builder.Add(docID, wordFreqs, normalize.StemmedWordFreqs(wordFreqs), positions)
+		titleFreqs := gatherWords(t, p.title)
+		builder.AddTitle(docID, titleFreqs, normalize.StemmedWordFreqs(titleFreqs))
+		aliasFreqs := map[string]int{}
+		for _, alias := range p.aliases {
+			redirects[alias] = p.title
+			for word, freq := range gatherWords(t, alias) {
+				aliasFreqs[word] += freq
+			}
+		}
+		builder.AddAliases(docID, aliasFreqs)
+		if ib := wiki.ParseInfobox(p.infobox); ib != nil {
+			builder.AddInfobox(docID, infoboxTerms(t, ib))
+			writeInfobox(t, savePath, doc.RelPath, ib)
+		}
+		for _, category := range p.categories {
+			members[normalize.Slug(category)] = append(members[normalize.Slug(category)], docID)
+		}
+	}
+	segmentDir := filepath.Join(savePath, constants.SegmentFileFolder)
+	if err := builder.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.Merge(segmentDir, filepath.Join(savePath, constants.IndexFileFolder), docs.Superseded); err != nil {
+		t.Fatal(err)
+	}
+
+	categoryDir := filepath.Join(savePath, constants.CategoryFolder)
+	if err := index.WriteSlugIndex(categoryDir, index.CategoryIndex, members); err != nil {
+		t.Fatal(err)
+	}
+	categories, err := index.OpenSlugIndex(categoryDir, index.CategoryIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = categories.Close() })
+
+	tokenCounts := docs.TokenCounts()
+	namespaceDocs, nonArticles := namespaceDocSets(docs.Namespaces())
+	superseded := supersededDocs(docs)
+	return &engine{
+		savePath:      savePath,
+		docs:          docs,
+		tokenCounts:   tokenCounts,
+		redirectSlugs: redirectSlugs(redirects),
+		categories:    categories,
+		backlinks:     &index.SlugIndex{},
+		manifest:      manifest,
+		namespaceDocs: namespaceDocs,
+		nonArticles:   nonArticles,
+		superseded:    superseded,
+		rankers: map[string]ranker{
+			"bm25":   newBM25Ranker(1.2, 0.75, bm25Weights{stem: 0.5, alias: 3, title: 3}, tokenCounts, superseded),
+			"legacy": legacyRanker{},
+		},
+		defaultRanker: "bm25",
+	}
+}
+
+func gatherWords(t *testing.T, text string) map[string]int {
+	t.Helper()
+	freqs, err := wiki.GatherWordFrequency(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return freqs
+}
+
+// infoboxTerms is the frequency of the words of every infobox field, the
+// way the indexer counts them.
+func infoboxTerms(t *testing.T, ib *wiki.Infobox) map[string]int {
+	t.Helper()
+	terms := map[string]int{}
+	for _, f := range ib.Fields {
+		for word, freq := range gatherWords(t, f.Text) {
+			terms[index.InfoboxTerm(normalize.InfoboxKey(f.Name), word)] += freq
+		}
+	}
+	return terms
+}
+
+// writeInfobox saves the infobox beside where the page would be saved.
+func writeInfobox(t *testing.T, savePath, relPath string, ib *wiki.Infobox) {
+	t.Helper()
+	path := filepath.Join(savePath, constants.PageFileFolder, strings.TrimSuffix(relPath, ".xml")+constants.InfoboxFileSuffix)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(ib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// searchTitles searches for q and returns the titles of the first page of
+// results, in order.
+func searchTitles(t *testing.T, e *engine, q string) []string {
+	t.Helper()
+	resp := runSearch(t, e, url.Values{"q": {q}})
+	titles := make([]string, 0, len(resp.Results))
+	for _, r := range resp.Results {
+		titles = append(titles, r.Title)
+	}
+	return titles
+}
+
+// runSearch runs the search the URL parameters ask for.
+func runSearch(t *testing.T, e *engine, params url.Values) SearchResponse {
+	t.Helper()
+	req, err := parseSearchRequest(e, httptest.NewRequest("GET", "/search?"+params.Encode(), nil), defaultPageSize)
+	if err != nil {
+		t.Fatalf("parseSearchRequest(%s) = %v", params, err)
+	}
+	resp, err := search(e, req)
+	if err != nil {
+		t.Fatalf("search(%s) = %v", params, err)
+	}
+	return resp
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/query"
+	"github.com/samiam2013/wiki4dummies/wiki"
+)
+
+// matchSet is the docs a query node matches. A negated set is every doc but
+// the ones in docs, so NOT can be evaluated without listing every doc.
+type matchSet struct {
+	docs    docSet
+	negated bool
+}
+
+// evaluate returns the docs matching the query. Stopwords aren't indexed so
+// parts of the query made of only stopwords are ignored, and queries with
+// nothing else, or only exclusions, match nothing.
+func evaluate(e *engine, postings *postingCache, n query.Node, stem bool) (docSet, error) {
+	ev := evaluator{e: e, postings: postings, stem: stem}
+	m, ok, err := ev.eval(n)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || m.negated {
+		return docSet{}, nil
+	}
+	if len(ev.e.superseded) == 0 {
+		return m.docs, nil
+	}
+	// the postings of docs superseded since their word files were merged
+	// are still there, m.docs can be one of the engine's sets so isn't
+	// changed in place
+	docs := make(docSet, len(m.docs))
+	for docID := range m.docs {
+		if _, ok := ev.e.superseded[docID]; !ok {
+			docs[docID] = struct{}{}
+		}
+	}
+	return docs, nil
+}
+
+type evaluator struct {
+	e        *engine
+	postings *postingCache
+	stem     bool
+}
+
+// eval reports ok false when the node doesn't constrain the results.
+func (ev evaluator) eval(n query.Node) (matchSet, bool, error) {
+	switch n := n.(type) {
+	case query.Term:
+		if _, ok := wiki.FrequentWords[n.Word]; ok {
+			return matchSet{}, false, nil
+		}
+		docs, err := termDocs(ev.postings, n.Word, ev.stem)
+		return matchSet{docs: docs}, true, err
+	case query.Phrase:
+		docs, ok, err := phraseDocs(ev.postings, n.Words)
+		return matchSet{docs: docs}, ok, err
+	case query.Near:
+		docs, ok, err := nearDocs(ev.postings, n)
+		return matchSet{docs: docs}, ok, err
+	case query.InTitle:
+		docs, ok, err := titleDocs(ev.postings, n.Words, ev.stem)
+		return matchSet{docs: docs}, ok, err
+	case query.InInfobox:
+		docs, ok, err := infoboxDocs(ev.postings, n.Key, n.Words)
+		return matchSet{docs: docs}, ok, err
+	case query.InNamespace:
+		key, err := ev.e.namespaceKey(n.Name)
+		if err != nil {
+			return matchSet{}, false, err
+		}
+		// articles are most of the index, so they're every doc but the rest
+		if key == 0 {
+			return matchSet{docs: ev.e.nonArticles, negated: true}, true, nil
+		}
+		return matchSet{docs: ev.e.namespaceDocs[key]}, true, nil
+	case query.InCategory:
+		docIDs, err := ev.e.categories.Get(n.Slug)
+		docs := make(docSet, len(docIDs))
+		for _, docID := range docIDs {
+			docs[docID] = struct{}{}
+		}
+		return matchSet{docs: docs}, true, err
+	case query.Not:
+		m, ok, err := ev.eval(n.Child)
+		m.negated = !m.negated
+		return m, ok, err
+	case query.And:
+		return ev.combine(n.Children, and)
+	case query.Or:
+		return ev.combine(n.Children, or)
+	case query.Clauses:
+		required := make([]query.Node, 0, len(n.Must)+len(n.MustNot)+len(n.Filter)+1)
+		required = append(required, n.Must...)
+		if len(n.Must) == 0 && len(n.Should) > 0 {
+			required = append(required, query.Or{Children: n.Should})
+		}
+		for _, c := range n.MustNot {
+			required = append(required, query.Not{Child: c})
+		}
+		required = append(required, n.Filter...)
+		return ev.combine(required, and)
+	default:
+		return matchSet{}, false, fmt.Errorf("unknown query node %T", n)
+	}
+}
+
+// combine folds op over the children that constrain the results.
+func (ev evaluator) combine(children []query.Node, op func(a, b matchSet) matchSet) (matchSet, bool, error) {
+	var acc matchSet
+	found := false
+	for _, c := range children {
+		m, ok, err := ev.eval(c)
+		if err != nil {
+			return matchSet{}, false, err
+		}
+		if !ok {
+			continue
+		}
+		if !found {
+			acc, found = m, true
+			continue
+		}
+		acc = op(acc, m)
+	}
+	return acc, found, nil
+}
+
+func and(a, b matchSet) matchSet {
+	switch {
+	case !a.negated && !b.negated:
+		return matchSet{docs: intersect(a.docs, b.docs)}
+	case !a.negated:
+		return matchSet{docs: subtract(a.docs, b.docs)}
+	case !b.negated:
+		return matchSet{docs: subtract(b.docs, a.docs)}
+	default:
+		return matchSet{docs: union(a.docs, b.docs), negated: true}
+	}
+}
+
+func or(a, b matchSet) matchSet {
+	switch {
+	case !a.negated && !b.negated:
+		return matchSet{docs: union(a.docs, b.docs)}
+	case !a.negated:
+		return matchSet{docs: subtract(b.docs, a.docs), negated: true}
+	case !b.negated:
+		return matchSet{docs: subtract(a.docs, b.docs), negated: true}
+	default:
+		return matchSet{docs: intersect(a.docs, b.docs), negated: true}
+	}
+}
+
+func intersect(a, b docSet) docSet {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	out := docSet{}
+	for docID := range a {
+		if _, ok := b[docID]; ok {
+			out[docID] = struct{}{}
+		}
+	}
+	return out
+}
+
+func union(a, b docSet) docSet {
+	out := make(docSet, len(a)+len(b))
+	for docID := range a {
+		out[docID] = struct{}{}
+	}
+	for docID := range b {
+		out[docID] = struct{}{}
+	}
+	return out
+}
+
+func subtract(a, b docSet) docSet {
+	out := docSet{}
+	for docID := range a {
+		if _, ok := b[docID]; !ok {
+			out[docID] = struct{}{}
+		}
+	}
+	return out
+}
+
+// termDocs is every doc with the word or, when stemming, a word with the
+// same stem.
+func termDocs(postings *postingCache, word string, stem bool) (docSet, error) {
+	lists, err := postings.wordLists(word, stem)
+	if err != nil {
+		return nil, err
+	}
+	docs := docSet{}
+	for _, l := range lists {
+		for l.it.Next() {
+			docs[l.it.DocID()] = struct{}{}
+		}
+		if err := l.it.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read postings for %s: %w", word, err)
+		}
+	}
+	return docs, nil
+}
+
+// titleDocs is the docs with every word in their title, or a word with the
+// same stem when stemming. ok is false if all the words are stopwords.
+func titleDocs(postings *postingCache, words []string, stem bool) (docs docSet, ok bool, err error) {
+	for _, word := range words {
+		if _, stop := wiki.FrequentWords[word]; stop {
+			continue
+		}
+		lists, err := postings.wordLists(word, stem)
+		if err != nil {
+			return nil, false, err
+		}
+		wordDocs := docSet{}
+		for _, l := range lists {
+			if l.field != index.FieldTitle && l.field != index.FieldTitleStemmed {
+				continue
+			}
+			for l.it.Next() {
+				wordDocs[l.it.DocID()] = struct{}{}
+			}
+			if err := l.it.Err(); err != nil {
+				return nil, false, fmt.Errorf("failed to read title postings for %s: %w", word, err)
+			}
+		}
+		if !ok {
+			docs, ok = wordDocs, true
+			continue
+		}
+		docs = intersect(docs, wordDocs)
+	}
+	return docs, ok, nil
+}
+
+// infoboxDocs is the docs with every word in their infobox's field with the
+// key. ok is false if all the words are stopwords.
+func infoboxDocs(postings *postingCache, key string, words []string) (docs docSet, ok bool, err error) {
+	for _, word := range words {
+		if _, stop := wiki.FrequentWords[word]; stop {
+			continue
+		}
+		pf, err := postings.get(index.InfoboxTerm(key, word))
+		if err != nil {
+			return nil, false, err
+		}
+		wordDocs := docSet{}
+		if pf != nil {
+			it := pf.List(index.FieldInfobox)
+			for it.Next() {
+				wordDocs[it.DocID()] = struct{}{}
+			}
+			if err := it.Err(); err != nil {
+				return nil, false, fmt.Errorf("failed to read infobox postings for %s: %w", word, err)
+			}
+		}
+		if !ok {
+			docs, ok = wordDocs, true
+			continue
+		}
+		docs = intersect(docs, wordDocs)
+	}
+	return docs, ok, nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestStemmedSearch(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: []testPage{
+		{title: "Running", text: "Running is a sport. Running is fast."},
+		{title: "Horse", text: "A horse runs on four legs."},
+		{title: "Sprint", text: "A sprint is a short race."},
+	}})
+	tests := []struct {
+		q, stem string
+		want    []string
+	}{
+		// the exact word ranks above words only sharing its stem
+		{"running", "on", []string{"Running", "Horse"}},
+		{"running", "off", []string{"Running"}},
+		{"runs", "off", []string{"Horse"}},
+		{"intitle:runs", "on", []string{"Running"}},
+		{"intitle:runs", "off", nil},
+		{"race", "on", []string{"Sprint"}},
+	}
+	for _, tt := range tests {
+		resp := runSearch(t, e, url.Values{"q": {tt.q}, "stem": {tt.stem}})
+		var got []string
+		for _, r := range resp.Results {
+			got = append(got, r.Title)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s, stem %q: results = %v, want %v", tt.q, tt.stem, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/wiki"
+)
+
+var infoboxPages = []testPage{
+	{title: "Nile", text: "The Nile flows north through Egypt.", aliases: []string{"River Nile"},
+		infobox: "{{Infobox river|name=Nile|source location=[[Lake Victoria]]|mouth=Mediterranean Sea}}"},
+	{title: "Congo", text: "The Congo flows west, crossing the equator twice.",
+		infobox: "{{Infobox river|name=Congo|Source_location=Lake Tanganyika|mouth=Atlantic Ocean}}"},
+	{title: "Lake Victoria", text: "Lake Victoria is the source of the Nile."},
+}
+
+func TestInfoboxSearch(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: infoboxPages})
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"infobox.source_location:lake", []string{"Congo", "Nile"}},
+		{"infobox.source_location:victoria", []string{"Nile"}},
+		{`infobox.mouth:"atlantic ocean"`, []string{"Congo"}},
+		{`infobox.mouth:"atlantic sea"`, nil},
+		{"infobox.source_location:lake +equator", []string{"Congo"}},
+		{"nile -infobox.mouth:mediterranean", []string{"Lake Victoria"}},
+		{"infobox.elevation:lake", nil},
+	}
+	for _, tt := range tests {
+		got := searchTitles(t, e, tt.q)
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s results = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestAPIInfobox(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: infoboxPages})
+	// Lake Victoria is saved, with no infobox
+	path := filepath.Join(e.savePath, constants.PageFileFolder, pageRelPath("lake-victoria"))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/page/{slug}/infobox", handleAPIInfobox(e))
+
+	for _, target := range []string{"/api/page/nile/infobox", "/api/page/river-nile/infobox"} {
+		var ib wiki.Infobox
+		if code := getJSON(t, mux, target, &ib); code != http.StatusOK {
+			t.Fatalf("%s status = %d, want 200", target, code)
+		}
+		if ib.Type != "river" || len(ib.Fields) != 3 || ib.Fields[1].Name != "source location" || ib.Fields[1].Text != "Lake Victoria" {
+			t.Errorf("%s infobox = %+v", target, ib)
+		}
+	}
+	for target, want := range map[string]string{
+		"/api/page/lake-victoria/infobox": "page has no infobox",
+		"/api/page/amazon/infobox":        "no such page",
+	} {
+		var apiErr apiError
+		if code := getJSON(t, mux, target, &apiErr); code != http.StatusNotFound || apiErr.Error != want {
+			t.Errorf("%s = %d %q, want 404 %q", target, code, apiErr.Error, want)
+		}
+	}
+}
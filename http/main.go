@@ -1,33 +1,46 @@
 package main
 
 import (
-	"bufio"
-	"encoding/xml"
 	"errors"
 	"flag"
 	"fmt"
 	"html/template"
-	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
-	"slices"
-	"sort"
-	"strings"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
 	"github.com/samiam2013/wiki4dummies/normalize"
-	"github.com/samiam2013/wiki4dummies/wiki"
-	"github.com/semantosoph/gowiki"
-	"golang.org/x/sync/errgroup"
 )
 
 func main() {
-	var savePath string
+	var savePath, defaultRanker, ollamaURL, ollamaModel string
+	var bm25K1, bm25B, priorWeight float64
+	var bm25Weights bm25Weights
+	var cacheEntries, cacheMB int
+	var cacheTTL time.Duration
 	flag.StringVar(&savePath, "save_path", "", "Path to the save index, page files")
+	flag.StringVar(&defaultRanker, "ranker", "bm25", "Ranking function, bm25 or legacy")
+	flag.Float64Var(&bm25K1, "bm25_k1", 1.2, "BM25 term frequency saturation")
+	flag.Float64Var(&bm25B, "bm25_b", 0.75, "BM25 document length normalization")
+	flag.Float64Var(&bm25Weights.stem, "bm25_stem_weight", 0.5,
+		"BM25 weight of a stemmed match relative to an exact one")
+	flag.Float64Var(&bm25Weights.alias, "bm25_alias_weight", 3,
+		"BM25 weight of a match in a redirect title relative to an exact one")
+	flag.Float64Var(&bm25Weights.title, "bm25_title_weight", 3,
+		"BM25 weight of a match in the page title relative to an exact one")
+	flag.Float64Var(&priorWeight, "prior_weight", 1,
+		"How much a page's PageRank prior, from 0 to 1, adds to its score, 0 to disable")
+	flag.StringVar(&ollamaURL, "ollama_url", "",
+		"Base URL of an Ollama compatible server for AI summaries, e.g. http://localhost:11434, empty to disable")
+	flag.StringVar(&ollamaModel, "ollama_model", "llama3.2", "Model to generate AI summaries with")
+	flag.IntVar(&cacheEntries, "cache_entries", 1000, "Maximum number of search results pages to cache")
+	flag.IntVar(&cacheMB, "cache_mb", 64, "Maximum size of the search results cache in MB")
+	flag.DurationVar(&cacheTTL, "cache_ttl", 5*time.Minute,
+		"How long search results are cached, and so how long AI summaries can be asked for")
 	flag.Parse()
 
 	if savePath == "" {
@@ -36,7 +49,78 @@ func main() {
 	}
 
 	fmt.Println("Initializing w4d server")
-	cache := newResultCache()
+	// check the index is searchable before opening any of it
+	manifest, err := index.ReadManifest(savePath)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("Index has no manifest, it's from before builds were recorded, rebuild it")
+		return
+	} else if err != nil {
+		fmt.Printf("Failed to read manifest: %v\n", err)
+		return
+	}
+	if err := manifest.Build.Compatible(index.CurrentBuild()); err != nil {
+		fmt.Printf("Can't search index, rebuild it: %v\n", err)
+		return
+	}
+	cache := newResultCache(cacheEntries, cacheMB*1024*1024, cacheTTL)
+	defer cache.close()
+	docs, err := index.OpenDocTableReadOnly(filepath.Join(savePath, constants.DocTableFolder))
+	if err != nil {
+		fmt.Printf("Failed to open doc table: %v\n", err)
+		return
+	}
+	defer func() { _ = docs.Close() }()
+	tokenCounts := docs.TokenCounts()
+	redirects, err := index.LoadRedirects(filepath.Join(savePath, constants.RedirectTableFolder))
+	if err != nil {
+		fmt.Printf("Failed to load redirects: %v\n", err)
+		return
+	}
+	backlinks, err := index.OpenSlugIndex(filepath.Join(savePath, constants.BacklinkFolder), index.BacklinkIndex)
+	if err != nil {
+		fmt.Printf("Failed to open backlinks: %v\n", err)
+		return
+	}
+	defer func() { _ = backlinks.Close() }()
+	categories, err := index.OpenSlugIndex(filepath.Join(savePath, constants.CategoryFolder), index.CategoryIndex)
+	if err != nil {
+		fmt.Printf("Failed to open categories: %v\n", err)
+		return
+	}
+	defer func() { _ = categories.Close() }()
+	priors, err := index.LoadPriors(filepath.Join(savePath, constants.PriorFolder))
+	if err != nil {
+		fmt.Printf("Failed to load priors: %v\n", err)
+		return
+	}
+	if priors != nil && len(priors) != docs.Len() {
+		fmt.Printf("Priors are for %d docs but %d are indexed, rerun pagerank\n", len(priors), docs.Len())
+	}
+	namespaceDocs, nonArticles := namespaceDocSets(docs.Namespaces())
+	superseded := supersededDocs(docs)
+	e := &engine{
+		savePath:      savePath,
+		docs:          docs,
+		tokenCounts:   tokenCounts,
+		redirectSlugs: redirectSlugs(redirects),
+		backlinks:     backlinks,
+		categories:    categories,
+		manifest:      manifest,
+		namespaceDocs: namespaceDocs,
+		nonArticles:   nonArticles,
+		superseded:    superseded,
+		priors:        priors,
+		priorWeight:   priorWeight,
+		rankers: map[string]ranker{
+			"bm25":   newBM25Ranker(bm25K1, bm25B, bm25Weights, tokenCounts, superseded),
+			"legacy": legacyRanker{},
+		},
+		defaultRanker: defaultRanker,
+	}
+	if _, ok := e.rankers[defaultRanker]; !ok {
+		fmt.Printf("Unknown ranker %q\n", defaultRanker)
+		return
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -45,42 +129,72 @@ func main() {
 	mux.HandleFunc("/static/", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "./"+r.URL.Path)
 	})
-	mux.HandleFunc("/search", handleSearch(savePath, cache))
-	mux.HandleFunc("/page/", handlePage(savePath))
-
-	err := http.ListenAndServe(":3030", mux)
+	var ollama *ollamaClient
+	if ollamaURL != "" {
+		ollama = newOllamaClient(ollamaURL, ollamaModel)
+		mux.HandleFunc("/ai-summary", handleAISummary(cache, ollama))
+	}
+	mux.HandleFunc("/search", handleSearch(e, cache, ollama != nil))
+	mux.HandleFunc("/api/search", handleAPISearch(e, cache))
+	mux.HandleFunc("/api/cache", handleCacheStats(cache))
+	mux.HandleFunc("/page/", handlePage(e))
+	mux.HandleFunc("/page/{slug}/backlinks", handleBacklinks(e))
+	mux.HandleFunc("/api/page/{slug}/infobox", handleAPIInfobox(e))
+	mux.HandleFunc("/category/{name}", handleCategory(e))
+	mux.HandleFunc("/api/category/{name}", handleAPICategory(e))
+
+	err = http.ListenAndServe(":3030", mux)
 	fmt.Printf("Server stopped, error: %v\n", err)
 }
 
 type SearchPageData struct {
-	Query         string
-	SearchTime    string
-	FilesReturned int ``
-	Results       []SearchResult
-	CacheKey      string // used for AI generated answers
+	Query      string
+	SearchTime string
+	TotalHits  int
+	Results    []SearchResult
+	CacheKey   string // used for AI generated answers
+	UseOllama  bool
+	// FirstResult and LastResult number the results on this page from 1
+	FirstResult int
+	LastResult  int
+	// PrevURL and NextURL are empty on the first and last pages
+	PrevURL string
+	NextURL string
 }
 
-type SearchResult struct {
-	Title    string
-	URL      string
-	Snippet  string
-	Abstract string // used for AI generated answers
-}
+// defaultPageSize is how many results the HTML results page shows.
+const defaultPageSize = 10
 
-func handleSearch(savePath string, cache *resultCache) http.HandlerFunc {
+func handleSearch(e *engine, cache *resultCache, useOllama bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		q := r.URL.Query().Get("q")
-		if strings.TrimSpace(q) == "" {
-			http.Error(w, "No query provided", http.StatusBadRequest)
+		req, err := parseSearchRequest(e, r, defaultPageSize)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		data, err := search(savePath, q)
+		resp, key, err := cachedSearch(e, cache, req)
 		if err != nil {
 			http.Error(w, "Failed to search", http.StatusInternalServerError)
 			fmt.Printf("Failed to search: %v\n", err)
 			return
 		}
+		data := SearchPageData{
+			Query:       resp.Query,
+			SearchTime:  resp.Took.Truncate(10 * time.Millisecond).String(),
+			TotalHits:   resp.TotalHits,
+			Results:     resp.Results,
+			CacheKey:    key,
+			UseOllama:   useOllama && len(resp.Results) > 0,
+			FirstResult: resp.Offset + 1,
+			LastResult:  resp.Offset + len(resp.Results),
+		}
+		if resp.Offset > 0 {
+			data.PrevURL = pageURL(r, max(0, resp.Offset-resp.Limit))
+		}
+		if resp.Offset+resp.Limit < resp.TotalHits {
+			data.NextURL = pageURL(r, resp.Offset+resp.Limit)
+		}
 
 		w.Header().Set("Content-Type", "text/html")
 		tmpl := template.Must(template.ParseFiles("./results.tmpl"))
@@ -91,313 +205,82 @@ func handleSearch(savePath string, cache *resultCache) http.HandlerFunc {
 	}
 }
 
-type idxRow struct {
-	WordFreq   int
-	ExactMatch bool
-	RelPath    string
-}
-
-type index []idxRow
-
-func asciiStringToInt(s string) int {
-	result := 0
-	for _, r := range s {
-		// Subtract '0' (ASCII 48) from the rune value to get the corresponding integer
-		result = result*10 + int(r-'0')
-	}
-	return result
+// pageURL is the search request's URL with the offset changed.
+func pageURL(r *http.Request, offset int) string {
+	params := r.URL.Query()
+	params.Set("offset", strconv.Itoa(offset))
+	return r.URL.Path + "?" + params.Encode()
 }
 
-func loadIndex(idxPath string) (index, error) {
-	f, err := os.Open(idxPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open index file: %w", err)
-	}
-	defer f.Close()
-
-	reader := bufio.NewReader(f)
-	rows := make([]idxRow, 0, 300_000)
-
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return nil, fmt.Errorf("failed to read line: %w", err)
-		}
-
-		// Split the line by commas
-		parts := strings.Split(line, ",")
-		if len(parts) != 3 {
-			fmt.Println("Invalid line format:", line)
+// namespaceDocSets groups the docs outside the main namespace by namespace.
+func namespaceDocSets(namespaces []uint32) (map[uint32]docSet, docSet) {
+	byNS := map[uint32]docSet{}
+	all := docSet{}
+	for docID, ns := range namespaces {
+		if ns == 0 {
 			continue
 		}
-
-		// Parse the fields
-		wordFreq := asciiStringToInt(parts[0])
-		exactMatch := (parts[1] == "true")
-		relPath := strings.TrimSpace(parts[2])
-
-		rows = append(rows, idxRow{WordFreq: wordFreq, ExactMatch: exactMatch, RelPath: relPath})
-	}
-
-	return rows, nil
-}
-
-const ExactMatchMultiplier = 3
-
-func search(savePath, q string) (SearchPageData, error) {
-	fmt.Printf("Searching for: %s\n", q)
-	startTime := time.Now()
-	// Search the index
-	indexPath := filepath.Join(savePath, constants.IndexFileFolder)
-	wordFreqs, err := wiki.GatherWordFrequency(strings.NewReader(q))
-	if err != nil {
-		return SearchPageData{}, fmt.Errorf("failed to gather word frequency: %w", err)
-	}
-	// TODO: evaluate the usefulness of stemming the search terms
-	// stemmedQueryWords := normalize.StemmedWordFreqs(wordFreqs)
-
-	loadIndexStart := time.Now()
-	indexes := map[string]index{}
-	pages := map[string]int{}
-	// for each exact match word look for an index file
-	for word := range wordFreqs {
-		triePath, err := normalize.TrieMake(indexPath, word)
-		if err != nil {
-			return SearchPageData{}, fmt.Errorf("failed to make trie path: %w", err)
-		}
-		idxSavePath := filepath.Join(triePath, word+".idx")
-		idxRows, err := loadIndex(idxSavePath)
-		if errors.Is(err, os.ErrNotExist) {
-			// no index file, no results
-			continue
-		}
-		if err != nil {
-			return SearchPageData{}, fmt.Errorf("failed to load index: %w", err)
-		}
-		indexes[word] = idxRows
-		for _, row := range idxRows {
-			if row.ExactMatch {
-				pages[row.RelPath] += ExactMatchMultiplier * row.WordFreq
-				continue
-			}
-			pages[row.RelPath] += row.WordFreq
+		if byNS[ns] == nil {
+			byNS[ns] = docSet{}
 		}
+		byNS[ns][uint32(docID)] = struct{}{}
+		all[uint32(docID)] = struct{}{}
 	}
-	fmt.Printf("Loaded indexes in %s\n", time.Since(loadIndexStart).String())
-
-	sortSliceTime := time.Now()
-	// sort the pages into a list of matches by index score
-	pagesByNumMatches := map[int][]string{}
-	maxScore := 0
-	for relPath, score := range pages {
-		pagesByNumMatches[score] = append(pagesByNumMatches[score], relPath)
-		if score > maxScore {
-			maxScore = score
-		}
-	}
-	fmt.Printf("Sorted pages in %s\n", time.Since(sortSliceTime).String())
+	return byNS, all
+}
 
-	const maxResults = 100
-	topResults := []string{}
-	for score := maxScore; score >= 0; score-- {
-		if len(pagesByNumMatches[score]) == 0 {
-			continue
-		}
-		for _, relPath := range pagesByNumMatches[score] {
-			topResults = append(topResults, relPath)
-			if len(topResults) >= maxResults {
-				break
-			}
-		}
-		if len(topResults) >= maxResults {
-			break
+func supersededDocs(docs *index.DocTable) docSet {
+	superseded := docSet{}
+	for docID := range uint32(docs.Len()) {
+		if docs.Superseded(docID) {
+			superseded[docID] = struct{}{}
 		}
 	}
+	return superseded
+}
 
-	type match struct {
-		relPath    string
-		indexScore int
-		textScore  int
+// namespaceKey looks up a namespace by its key, its slugged name or, for the
+// articles, "article" or "main".
+func (e *engine) namespaceKey(name string) (uint32, error) {
+	switch name {
+	case "0", "article", "articles", "main":
+		return 0, nil
 	}
-	type syncMatchList struct {
-		mutex   sync.Mutex
-		matches []match
-	}
-	// for each page, load the page file and search for the query
-	startScorePages := time.Now()
-	syncList := syncMatchList{mutex: sync.Mutex{}, matches: []match{}}
-	eg := errgroup.Group{} // TODO don't need this
-	for relPath, score := range pages {
-		// TODO this is kludgy, should be removed earlier or something
-		if !slices.Contains(topResults, relPath) {
-			continue
+	if key, err := strconv.Atoi(name); err == nil && key >= 0 {
+		if _, ok := e.manifest.Namespace(name); ok {
+			return uint32(key), nil
 		}
-		eg.Go(func(relPath string, score int) func() error {
-			return func() error {
-				var m match
-				m.relPath = relPath
-				m.indexScore = score
-				pagePath := filepath.Join(savePath, constants.PageFileFolder, relPath)
-				textScore, err := scorePageMatch(pagePath, q)
-				if err != nil {
-					return fmt.Errorf("failed to score page match: %w", err)
-				}
-				m.textScore = textScore
-				syncList.mutex.Lock()
-				syncList.matches = append(syncList.matches, m)
-				syncList.mutex.Unlock()
-				return nil
-			}
-		}(relPath, score))
 	}
-	if err := eg.Wait(); err != nil {
-		return SearchPageData{}, fmt.Errorf("failed page search(es): %w", err)
-	}
-
-	matchList := syncList.matches
-	sort.Slice(matchList, func(i, j int) bool {
-		if matchList[i].indexScore+matchList[i].textScore == matchList[j].indexScore+matchList[j].textScore {
-			return matchList[i].indexScore > matchList[j].indexScore
+	for _, ns := range e.manifest.Namespaces {
+		if ns.Key >= 0 && ns.Name != "" && normalize.Slug(ns.Name) == name {
+			return uint32(ns.Key), nil
 		}
-		return matchList[i].indexScore+matchList[i].textScore > matchList[j].indexScore+matchList[j].textScore
-	})
-	fmt.Printf("Scored pages in %s\n", time.Since(startScorePages).String())
-
-	startGetPageData := time.Now()
-	spd := SearchPageData{Query: q, Results: []SearchResult{}}
-	spd.FilesReturned = len(pages)
-	for _, m := range matchList {
-		// fmt.Printf("Match: %s, indexScore: %d, textScore: %d\n", m.relPath, m.indexScore, m.textScore)
-		var sr SearchResult
-		filePath := filepath.Join(savePath, constants.PageFileFolder, m.relPath)
-		fh, err := os.Open(filePath)
-		if err != nil {
-			fmt.Println("Failed to open page file:", err)
-			continue
-		}
-		pageBuffer, err := io.ReadAll(fh)
-		if err != nil {
-			fmt.Println("Failed to read page file:", err)
-			continue
-		}
-		title, abstract, text, err := parsePage(pageBuffer)
-		if err != nil {
-			fmt.Println("Failed to parse page:", err)
-			continue
-		}
-		sr.Title = title
-		sr.Abstract = abstract
-		sr.URL = fmt.Sprintf("/page/%s", m.relPath)
-		if abstract != "" {
-			sr.Snippet = abstract
-		} else {
-			sr.Snippet = text
-		}
-		const snippetMaxLen = 300
-		if len(sr.Snippet) > snippetMaxLen {
-			sr.Snippet = sr.Snippet[:snippetMaxLen]
-			lastSpace := strings.LastIndex(sr.Snippet, " ")
-			sr.Snippet = sr.Snippet[:lastSpace]
-			sr.Snippet += "..."
-		}
-		spd.Results = append(spd.Results, sr)
 	}
-	fmt.Printf("Got page data in %s\n", time.Since(startGetPageData).String())
-
-	spd.SearchTime = time.Since(startTime).Truncate(10 * time.Millisecond).String()
-	return spd, nil
+	return 0, fmt.Errorf("unknown namespace %s", name)
 }
 
-// parsePage returns title, abstract, text, error and only contains the text if
-// it was not able to parse the abstract
-func parsePage(pageBuffer []byte) (string, string, string, error) {
-	var page wiki.Page
-	if err := xml.Unmarshal(pageBuffer, &page); err != nil {
-		return "", "", "", fmt.Errorf("failed to unmarshal page: %w", err)
-	}
-
-	article, err := gowiki.ParseArticle(page.Title, page.Revision.Text.Text, &gowiki.DummyPageGetter{})
-	if err != nil {
-		return "", "", "", fmt.Errorf("failed to parse article: %w", err)
+// prior is how much the doc's PageRank adds to its score.
+func (e *engine) prior(docID uint32) float64 {
+	if int(docID) >= len(e.priors) {
+		return 0
 	}
-
-	abstract := article.GetAbstract()
-	abstract = strings.ReplaceAll(abstract, "\n", "")
-	pageText := article.GetText()
-
-	return page.Title, abstract, pageText, nil
-}
-
-func scorePageMatch(pagePath, q string) (int, error) {
-	words := strings.Fields(strings.ToLower(q))
-	f, err := os.Open(pagePath)
-	if err != nil {
-		return 0, fmt.Errorf("failed to open page file: %w", err)
-	}
-	defer f.Close()
-	var matches int
-	// scan over each line and count the number of times the words appear
-	sc := bufio.NewScanner(f)
-	for sc.Scan() {
-		line := strings.ToLower(sc.Text())
-		for _, word := range words {
-			matches += strings.Count(line, word)
-		}
-	}
-	if err := sc.Err(); err != nil {
-		return 0, fmt.Errorf("failed to scan page file: %w", err)
-	}
-	return matches, nil
+	return e.priorWeight * float64(e.priors[docID])
 }
 
-func handlePage(savePath string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		relPath := strings.TrimPrefix(r.URL.Path, "/page/")
-		if relPath == "" {
-			http.Error(w, "No page provided", http.StatusBadRequest)
-			return
-		}
-
-		// Load the page file
-		pagePath := filepath.Join(savePath, constants.PageFileFolder, relPath)
-		f, err := os.Open(pagePath)
-		if err != nil {
-			http.Error(w, "Failed to open page", http.StatusInternalServerError)
-			fmt.Printf("Failed to open page: %v\n", err)
-			return
-		}
-		defer f.Close()
-
-		pageBuffer, err := io.ReadAll(f)
-		if err != nil {
-			http.Error(w, "Failed to read page", http.StatusInternalServerError)
-			fmt.Printf("Failed to read page: %v\n", err)
-			return
-		}
-		var wikiPage wiki.Page
-		if err := xml.Unmarshal(pageBuffer, &wikiPage); err != nil {
-			http.Error(w, "Failed to unmarshal page", http.StatusInternalServerError)
-			fmt.Printf("Failed to unmarshal page: %v\n", err)
-			return
-		}
-		// Parse the page
-		article, err := gowiki.ParseArticle(wikiPage.Title, wikiPage.Revision.Text.Text, &gowiki.DummyPageGetter{})
-		if err != nil {
-			http.Error(w, "Failed to parse article", http.StatusInternalServerError)
-			fmt.Printf("Failed to parse article: %v\n", err)
-			return
-		}
-		text := article.GetText()
-		// limit any number of \n to 2
-		newlinesRE := regexp.MustCompile(`\n{3,}`)
-		text = newlinesRE.ReplaceAllString(text, "\n\n")
-		if _, err := w.Write([]byte(text)); err != nil {
-			http.Error(w, "Failed to write article", http.StatusInternalServerError)
-			fmt.Printf("Failed to write article: %v\n", err)
-			return
-		}
-	}
+// engine is what searches need that's loaded once at startup.
+type engine struct {
+	savePath      string
+	docs          *index.DocTable
+	redirectSlugs map[string]string // redirect page slug to target title
+	backlinks     *index.SlugIndex
+	categories    *index.SlugIndex
+	manifest      index.Manifest
+	namespaceDocs map[uint32]docSet // namespace key to its docs, for all but articles
+	nonArticles   docSet
+	superseded    docSet    // docs of pages indexed again since
+	priors        []float32 // by doc ID, nil if pagerank hasn't been run
+	priorWeight   float64
+	tokenCounts   []uint32
+	rankers       map[string]ranker
+	defaultRanker string
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tiedPages all score the same for "moss", so only the doc ID orders them.
+func tiedPages(n int) []testPage {
+	pages := make([]testPage, n)
+	for i := range pages {
+		pages[i] = testPage{title: fmt.Sprintf("Moss %02d", i), text: "Moss grows here."}
+	}
+	return pages
+}
+
+func TestSearchPagination(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: append(tiedPages(7),
+		testPage{title: "Moss", text: "Moss, moss and more moss."},
+		testPage{title: "Lichen", text: "Not a plant."})})
+
+	all := searchTitles(t, e, "moss")
+	if len(all) != 8 || all[0] != "Moss" {
+		t.Fatalf("moss results = %v, want Moss first of 8", all)
+	}
+	// ties keep doc ID order
+	if !slices.Equal(all[1:], searchTitles(t, e, "moss")[1:]) || all[1] != "Moss 00" || all[7] != "Moss 06" {
+		t.Errorf("tied results = %v, want doc ID order", all[1:])
+	}
+
+	var paged []string
+	for offset := 0; ; offset += 3 {
+		resp := runSearch(t, e, url.Values{"q": {"moss"}, "offset": {fmt.Sprint(offset)}, "limit": {"3"}})
+		if resp.TotalHits != 8 || resp.Offset != offset || resp.Limit != 3 {
+			t.Fatalf("offset %d: total %d, offset %d, limit %d", offset, resp.TotalHits, resp.Offset, resp.Limit)
+		}
+		if len(resp.Results) == 0 {
+			break
+		}
+		for _, r := range resp.Results {
+			paged = append(paged, r.Title)
+		}
+	}
+	if !slices.Equal(paged, all) {
+		t.Errorf("paged results = %v, want %v", paged, all)
+	}
+}
+
+func TestSearchPageLinks(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: tiedPages(25)})
+	cache := newResultCache(10, 1<<20, time.Minute)
+	defer cache.close()
+	h := handleSearch(e, cache, false)
+	tests := []struct {
+		offset     string
+		prev, next string // the offsets linked to, empty for no link
+		span       string
+	}{
+		{"0", "", "10", "1&ndash;10 of 25"},
+		{"10", "0", "20", "11&ndash;20 of 25"},
+		{"20", "10", "", "21&ndash;25 of 25"},
+		{"5", "0", "15", "6&ndash;15 of 25"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/search?q=moss&offset="+tt.offset, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("offset %s: status %d, %s", tt.offset, rec.Code, rec.Body)
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, tt.span) {
+			t.Errorf("offset %s: page is missing %q", tt.offset, tt.span)
+		}
+		for _, link := range []struct{ offset, label string }{{tt.prev, "Previous"}, {tt.next, "Next"}} {
+			href := `href="/search?offset=` + link.offset + `&amp;q=moss"`
+			has := strings.Contains(body, href)
+			if has != (link.offset != "") || strings.Contains(body, link.label) != (link.offset != "") {
+				t.Errorf("offset %s: %s link to %q, page has it %t", tt.offset, link.label, link.offset, has)
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestNamespaceSearch(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: []testPage{
+		{title: "Fern", text: "A fern is a plant."},
+		{title: "Talk:Fern", text: "Is a fern really a plant?", ns: 1},
+		{title: "Category:Plants", text: "Every plant, fern and moss.", ns: 14},
+		{title: "Wikipedia:Plants", text: "How plant articles are written.", ns: 4},
+	}})
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"plant", []string{"Fern"}}, // only articles unless asked
+		{"plant ns:talk", []string{"Talk:Fern"}},
+		{"plant ns:1", []string{"Talk:Fern"}},
+		{"plant (ns:article OR ns:category)", []string{"Category:Plants", "Fern"}},
+		{"plant -ns:main", []string{"Category:Plants", "Talk:Fern", "Wikipedia:Plants"}},
+		{"ns:wikipedia", []string{"Wikipedia:Plants"}},
+	}
+	for _, tt := range tests {
+		got := searchTitles(t, e, tt.q)
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s results = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+
+	for _, q := range []string{"plant ns:user", "plant ns:2"} {
+		params := url.Values{"q": {q}}
+		if _, err := parseSearchRequest(e, httptest.NewRequest("GET", "/search?"+params.Encode(), nil), defaultPageSize); err == nil {
+			t.Errorf("parseSearchRequest(%s) accepted an unknown namespace", q)
+		}
+	}
+}
+
+func TestNamespaceDocSets(t *testing.T) {
+	byNS, nonArticles := namespaceDocSets([]uint32{0, 1, 14, 0, 1, 4294967295})
+	if len(byNS) != 3 || len(byNS[1]) != 2 || len(byNS[14]) != 1 || len(byNS[4294967295]) != 1 {
+		t.Errorf("docs by namespace = %v", byNS)
+	}
+	want := docSet{1: {}, 2: {}, 4: {}, 5: {}}
+	if len(nonArticles) != len(want) {
+		t.Errorf("non-articles = %v, want %v", nonArticles, want)
+	}
+	for docID := range want {
+		if _, ok := nonArticles[docID]; !ok {
+			t.Errorf("non-articles = %v, want %v", nonArticles, want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ollamaClient talks to an Ollama compatible /api/generate endpoint, so a
+// local Ollama or anything speaking its streaming protocol, like a stub
+// server, can answer.
+type ollamaClient struct {
+	baseURL    string
+	model      string
+	httpClient *http.Client
+}
+
+func newOllamaClient(baseURL, model string) *ollamaClient {
+	return &ollamaClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		model:      model,
+		httpClient: &http.Client{},
+	}
+}
+
+type generateRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	Stream bool   `json:"stream"`
+}
+
+// generateChunk is one line of the streamed response.
+type generateChunk struct {
+	Response string `json:"response"`
+	Done     bool   `json:"done"`
+	Error    string `json:"error"`
+}
+
+// generate streams the model's answer to the prompt, calling fn with each
+// piece of text as it arrives.
+func (c *ollamaClient) generate(ctx context.Context, prompt string, fn func(text string) error) error {
+	body, err := json.Marshal(generateRequest{Model: c.model, Prompt: prompt, Stream: true})
+	if err != nil {
+		return fmt.Errorf("failed to marshal generate request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/generate", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create generate request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call generate: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("generate returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	s := bufio.NewScanner(resp.Body)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for s.Scan() {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk generateChunk
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal generate response: %w", err)
+		}
+		if chunk.Error != "" {
+			return fmt.Errorf("generate failed: %s", chunk.Error)
+		}
+		if chunk.Response != "" {
+			if err := fn(chunk.Response); err != nil {
+				return err
+			}
+		}
+		if chunk.Done {
+			return nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("failed to read generate response: %w", err)
+	}
+	return errors.New("generate response ended before it was done")
+}
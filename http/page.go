@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/normalize"
+	"github.com/samiam2013/wiki4dummies/wiki"
+)
+
+// redirectSlugs keys the redirects by the slug their page would be saved
+// under, resolved to the page they end at.
+func redirectSlugs(redirects map[string]string) map[string]string {
+	slugs := make(map[string]string, len(redirects))
+	for from := range redirects {
+		slugs[normalize.Slug(from)] = index.ResolveRedirect(redirects, from)
+	}
+	return slugs
+}
+
+// pageRelPath is where the page with the slug is saved under the pages dir.
+func pageRelPath(slug string) string {
+	return filepath.Join(normalize.TriePath("", slug), slug+".xml")
+}
+
+// articleURL is where a link to the title goes, its page if it was indexed
+// or a redirect to one, otherwise a search for it.
+func (e *engine) articleURL(title string) string {
+	if name, ok := cutCategoryPrefix(title); ok {
+		return categoryURL(name)
+	}
+	slug := normalize.Slug(title)
+	if _, ok := e.redirectSlugs[slug]; ok {
+		return "/page/" + slug
+	}
+	if _, err := os.Stat(filepath.Join(e.savePath, constants.PageFileFolder, pageRelPath(slug))); err == nil {
+		return "/page/" + slug
+	}
+	return "/search?q=" + url.QueryEscape(title)
+}
+
+// cutCategoryPrefix reports whether the title is a category's, returning
+// the category's name.
+func cutCategoryPrefix(title string) (string, bool) {
+	if len(title) < len("category:") || !strings.EqualFold(title[:len("category:")], "category:") {
+		return "", false
+	}
+	return strings.TrimSpace(title[len("category:"):]), true
+}
+
+// categoryURL is where the category with the name is browsed.
+func categoryURL(name string) string {
+	return "/category/" + url.PathEscape(strings.ReplaceAll(name, " ", "_"))
+}
+
+// readPage loads the saved page at relPath under the pages dir.
+func (e *engine) readPage(relPath string) (wiki.Page, error) {
+	b, err := os.ReadFile(filepath.Join(e.savePath, constants.PageFileFolder, relPath))
+	if err != nil {
+		return wiki.Page{}, fmt.Errorf("failed to read page: %w", err)
+	}
+	var page wiki.Page
+	if err := xml.Unmarshal(b, &page); err != nil {
+		return wiki.Page{}, fmt.Errorf("failed to unmarshal page: %w", err)
+	}
+	return page, nil
+}
+
+type ArticlePageData struct {
+	Title      string
+	Slug       string
+	Sections   []wiki.Section
+	Infobox    *InfoboxTable
+	Body       template.HTML
+	Categories []PageRef
+}
+
+// InfoboxTable is an infobox ready to show beside the article.
+type InfoboxTable struct {
+	Title string
+	Rows  []InfoboxRow
+}
+
+type InfoboxRow struct {
+	Name  string
+	Value template.HTML
+}
+
+// infoboxTable renders the infobox's values, dropping rows that were only
+// templates.
+func infoboxTable(title string, ib *wiki.Infobox, link wiki.LinkFunc) *InfoboxTable {
+	if ib == nil {
+		return nil
+	}
+	t := &InfoboxTable{Title: title}
+	for _, f := range ib.Fields {
+		value := wiki.RenderInline(f.Value, link)
+		if value == "" {
+			continue
+		}
+		name := strings.ReplaceAll(f.Name, "_", " ")
+		if name != "" {
+			name = strings.ToUpper(name[:1]) + name[1:]
+		}
+		// rendered from the wikitext, which escapes everything it doesn't
+		// turn into markup itself
+		t.Rows = append(t.Rows, InfoboxRow{Name: name, Value: template.HTML(value)})
+	}
+	if len(t.Rows) == 0 {
+		return nil
+	}
+	return t
+}
+
+// handlePage serves a page by its saved path, or by its bare slug, rendered
+// as HTML. Slugs of redirects are sent on to the page they point at.
+func handlePage(e *engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		relPath := strings.TrimPrefix(r.URL.Path, "/page/")
+		if relPath == "" {
+			http.Error(w, "No page provided", http.StatusBadRequest)
+			return
+		}
+		if !strings.Contains(relPath, "/") {
+			relPath = pageRelPath(relPath)
+		}
+
+		wikiPage, err := e.readPage(relPath)
+		if errors.Is(err, os.ErrNotExist) {
+			slug := strings.TrimSuffix(filepath.Base(relPath), ".xml")
+			if target, ok := e.redirectSlugs[slug]; ok {
+				http.Redirect(w, r, "/page/"+pageRelPath(normalize.Slug(target)), http.StatusMovedPermanently)
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to read page", http.StatusInternalServerError)
+			fmt.Printf("Failed to read page: %v\n", err)
+			return
+		}
+
+		text := wikiPage.Revision.Text.Text
+		rendered := wiki.RenderHTML(text, e.articleURL)
+		data := ArticlePageData{
+			Title:    wikiPage.Title,
+			Slug:     normalize.Slug(wikiPage.Title),
+			Sections: rendered.Sections,
+			Infobox:  infoboxTable(wikiPage.Title, wiki.ParseInfobox(text), e.articleURL),
+			// RenderHTML escapes all of the page's own text
+			Body: template.HTML(rendered.HTML),
+		}
+		for _, name := range rendered.Categories {
+			data.Categories = append(data.Categories, PageRef{Title: name, URL: categoryURL(name)})
+		}
+		w.Header().Set("Content-Type", "text/html")
+		tmpl := template.Must(template.ParseFiles("./page.tmpl"))
+		if err := tmpl.Execute(w, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// handleAPIInfobox serves the infobox the indexer extracted from the page
+// with the slug, or from the page a redirect's slug points at.
+func handleAPIInfobox(e *engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := r.PathValue("slug")
+		if target, ok := e.redirectSlugs[slug]; ok {
+			slug = normalize.Slug(target)
+		}
+		relPath := pageRelPath(slug)
+		b, err := os.ReadFile(filepath.Join(e.savePath, constants.PageFileFolder,
+			strings.TrimSuffix(relPath, ".xml")+constants.InfoboxFileSuffix))
+		if errors.Is(err, os.ErrNotExist) {
+			if _, err := os.Stat(filepath.Join(e.savePath, constants.PageFileFolder, relPath)); err != nil {
+				writeJSON(w, http.StatusNotFound, apiError{Error: "no such page"})
+				return
+			}
+			writeJSON(w, http.StatusNotFound, apiError{Error: "page has no infobox"})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: "failed to read infobox"})
+			fmt.Printf("Failed to read infobox: %v\n", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, json.RawMessage(b))
+	}
+}
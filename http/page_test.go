@@ -0,0 +1,54 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRedirectAwareSearch(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: []testPage{
+		{title: "United States", text: "A country in North America.", aliases: []string{"USA", "United States of America"}},
+		{title: "USA Today", text: "A newspaper."},
+		{title: "Travel", text: "Visiting the USA needs a visa, as does going to Canada."},
+	}})
+	// a redirect title is a strong match, like the page's own title, and far
+	// stronger than a mention in the text
+	if got, want := searchTitles(t, e, "usa"), []string{"USA Today", "United States", "Travel"}; !slices.Equal(got, want) {
+		t.Errorf("usa results = %v, want %v", got, want)
+	}
+	if got := searchTitles(t, e, `"america"`); !slices.Equal(got, []string{"United States"}) {
+		t.Errorf("america results = %v, want [United States]", got)
+	}
+}
+
+func TestRedirectSlugs(t *testing.T) {
+	got := redirectSlugs(map[string]string{
+		"USA":                      "United States",
+		"United States of America": "USA",
+		"Loop":                     "Loop",
+	})
+	want := map[string]string{
+		"usa":                      "United States",
+		"united-states-of-america": "United States",
+		"loop":                     "Loop",
+	}
+	if len(got) != len(want) {
+		t.Errorf("redirectSlugs() = %v, want %v", got, want)
+	}
+	for slug, title := range want {
+		if got[slug] != title {
+			t.Errorf("redirectSlugs()[%s] = %q, want %q", slug, got[slug], title)
+		}
+	}
+
+	e := &engine{savePath: t.TempDir(), redirectSlugs: got}
+	for title, want := range map[string]string{
+		"USA":             "/page/usa",
+		"Category:Plants": "/category/Plants",
+		"Nowhere":         "/search?q=Nowhere",
+	} {
+		if url := e.articleURL(title); url != want {
+			t.Errorf("articleURL(%s) = %s, want %s", title, url, want)
+		}
+	}
+}
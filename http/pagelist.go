@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+// listPageSize is how many pages a list of them shows at once, the most
+// linked pages and biggest categories have hundreds of thousands.
+const listPageSize = 100
+
+// PageListData is a titled list of pages, split into pages of its own.
+type PageListData struct {
+	Title   string
+	Heading string
+	Pages   []PageRef
+	Total   int
+	PrevURL string
+	NextURL string
+}
+
+type PageRef struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// parseListWindow reads the offset and limit parameters of a page list.
+func parseListWindow(r *http.Request, defaultLimit int) (offset, limit int, err error) {
+	params := r.URL.Query()
+	limit = defaultLimit
+	if s := params.Get("offset"); s != "" {
+		offset, err = strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative number")
+		}
+	}
+	if s := params.Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+	}
+	return offset, limit, nil
+}
+
+// pageRefs looks up the docs in the window of docIDs.
+func (e *engine) pageRefs(docIDs []uint32, offset, limit int) ([]PageRef, error) {
+	end := min(offset+limit, len(docIDs))
+	refs := make([]PageRef, 0, max(0, end-offset))
+	for _, docID := range docIDs[min(offset, end):end] {
+		doc, err := e.docs.Get(docID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get doc: %w", err)
+		}
+		refs = append(refs, PageRef{Title: doc.Title, URL: "/page/" + doc.RelPath})
+	}
+	return refs, nil
+}
+
+// writePageList renders the window of docIDs starting at offset, with links
+// to the windows either side.
+func writePageList(e *engine, w http.ResponseWriter, r *http.Request, data PageListData,
+	docIDs []uint32, offset, limit int) {
+	pages, err := e.pageRefs(docIDs, offset, limit)
+	if err != nil {
+		http.Error(w, "Failed to list pages", http.StatusInternalServerError)
+		fmt.Printf("Failed to list pages: %v\n", err)
+		return
+	}
+	data.Pages = pages
+	data.Total = len(docIDs)
+	if offset > 0 {
+		data.PrevURL = pageURL(r, max(0, offset-limit))
+	}
+	if offset+limit < len(docIDs) {
+		data.NextURL = pageURL(r, offset+limit)
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	tmpl := template.Must(template.ParseFiles("./pagelist.tmpl"))
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
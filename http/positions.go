@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/normalize"
+	"github.com/samiam2013/wiki4dummies/query"
+	"github.com/samiam2013/wiki4dummies/wiki"
+)
+
+// postingCache loads each word's index file at most once per search.
+type postingCache struct {
+	indexPath string
+	files     map[string]*index.PostingFile
+}
+
+func newPostingCache(indexPath string) *postingCache {
+	return &postingCache{indexPath: indexPath, files: map[string]*index.PostingFile{}}
+}
+
+// get returns nil when the word isn't in the index.
+func (c *postingCache) get(word string) (*index.PostingFile, error) {
+	if pf, ok := c.files[word]; ok {
+		return pf, nil
+	}
+	idxPath, err := index.TermPath(c.indexPath, word)
+	if err != nil {
+		return nil, err
+	}
+	pf, err := index.ReadPostingFile(idxPath)
+	if errors.Is(err, os.ErrNotExist) {
+		c.files[word] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index for %s: %w", word, err)
+	}
+	c.files[word] = pf
+	return pf, nil
+}
+
+// wordList is one posting list a query word is looked up in.
+type wordList struct {
+	field index.Field
+	it    index.PostingIterator
+}
+
+// wordLists are the lists a query word matches: its exact postings in the
+// text and title, the pages it's in a redirect title of and, with stemming on,
+// the stemmed postings indexed under its stem so "running" also finds pages
+// that only say "runs".
+func (c *postingCache) wordLists(word string, stem bool) ([]wordList, error) {
+	lists := make([]wordList, 0, 2)
+	pf, err := c.get(word)
+	if err != nil {
+		return nil, err
+	}
+	if pf != nil {
+		lists = append(lists,
+			wordList{field: index.FieldExact, it: pf.List(index.FieldExact)},
+			wordList{field: index.FieldTitle, it: pf.List(index.FieldTitle)},
+			wordList{field: index.FieldAlias, it: pf.List(index.FieldAlias)})
+	}
+	if !stem {
+		return lists, nil
+	}
+	pf, err = c.get(normalize.Stem(word))
+	if err != nil {
+		return nil, err
+	}
+	if pf != nil {
+		lists = append(lists,
+			wordList{field: index.FieldStemmed, it: pf.List(index.FieldStemmed)},
+			wordList{field: index.FieldTitleStemmed, it: pf.List(index.FieldTitleStemmed)})
+	}
+	return lists, nil
+}
+
+// wordPositions maps each doc containing word to where the word occurs in it.
+// ok is false if the index was built without positions, the map then has
+// every doc with no positions.
+func (c *postingCache) wordPositions(word string) (map[uint32][]uint32, bool, error) {
+	pf, err := c.get(word)
+	if err != nil || pf == nil {
+		return map[uint32][]uint32{}, true, err
+	}
+	it := pf.List(index.FieldExact)
+	docs := make(map[uint32][]uint32, it.Len())
+	for it.Next() {
+		docs[it.DocID()] = it.Positions(nil)
+	}
+	if err := it.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to read postings for %s: %w", word, err)
+	}
+	return docs, it.HasPositions(), nil
+}
+
+type docSet map[uint32]struct{}
+
+// phraseWord is an indexed word of a phrase and where it sits in the phrase.
+type phraseWord struct {
+	offset    uint32
+	positions map[uint32][]uint32
+}
+
+// phraseDocs returns the docs containing the phrase's words in order. Only the
+// words that are indexed are checked, at their offsets within the phrase, so
+// "bank of america" matches "bank" then anything then "america". Without
+// positions in the index it falls back to the docs having all the words.
+// constrained is false when the phrase is all stopwords and matches anything.
+func phraseDocs(c *postingCache, phrase []string) (docs docSet, constrained bool, err error) {
+	words := make([]phraseWord, 0, len(phrase))
+	havePositions := true
+	for offset, word := range phrase {
+		if _, ok := wiki.FrequentWords[word]; ok {
+			continue
+		}
+		positions, ok, err := c.wordPositions(word)
+		if err != nil {
+			return nil, false, err
+		}
+		havePositions = havePositions && ok
+		words = append(words, phraseWord{offset: uint32(offset), positions: positions})
+	}
+	if len(words) == 0 {
+		return nil, false, nil
+	}
+
+	docs = docSet{}
+	for docID, firstPositions := range words[0].positions {
+		if havePositions {
+			if phraseAt(docID, firstPositions, words) {
+				docs[docID] = struct{}{}
+			}
+			continue
+		}
+		inAll := true
+		for _, w := range words[1:] {
+			if _, ok := w.positions[docID]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			docs[docID] = struct{}{}
+		}
+	}
+	return docs, true, nil
+}
+
+// phraseAt reports whether, for some occurrence of the first word, every
+// other word of the phrase is at its offset from it.
+func phraseAt(docID uint32, firstPositions []uint32, words []phraseWord) bool {
+	for _, p := range firstPositions {
+		if p < words[0].offset {
+			continue
+		}
+		start := p - words[0].offset
+		matched := true
+		for _, w := range words[1:] {
+			if _, found := slices.BinarySearch(w.positions[docID], start+w.offset); !found {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// nearDocs returns the docs where the two words are within the NEAR's
+// distance of each other, or that have both words if the index has no
+// positions. constrained is false if either word is a stopword.
+func nearDocs(c *postingCache, n query.Near) (docs docSet, constrained bool, err error) {
+	for _, word := range []string{n.Left, n.Right} {
+		if _, ok := wiki.FrequentWords[word]; ok {
+			return nil, false, nil
+		}
+	}
+	left, leftOK, err := c.wordPositions(n.Left)
+	if err != nil {
+		return nil, false, err
+	}
+	right, rightOK, err := c.wordPositions(n.Right)
+	if err != nil {
+		return nil, false, err
+	}
+	docs = docSet{}
+	for docID, leftPositions := range left {
+		rightPositions, ok := right[docID]
+		if !ok {
+			continue
+		}
+		if !leftOK || !rightOK || withinDistance(leftPositions, rightPositions, uint32(n.Distance)) {
+			docs[docID] = struct{}{}
+		}
+	}
+	return docs, true, nil
+}
+
+// withinDistance walks two sorted position lists looking for a close pair.
+func withinDistance(a, b []uint32, distance uint32) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] < b[j] {
+			if b[j]-a[i] <= distance {
+				return true
+			}
+			i++
+			continue
+		}
+		if a[i]-b[j] <= distance {
+			return true
+		}
+		j++
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+var phrasePages = []testPage{
+	{title: "Bank of America", text: "Bank of America is a bank in America."},
+	{title: "America", text: "America has a central bank, the bank of the nation."},
+	{title: "Green plant", text: "A green plant uses light. Plants that are green are common."},
+	{title: "Plant pigments", text: "The plant is green because of chlorophyll."},
+}
+
+func TestPhraseQueries(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: phrasePages, positions: true})
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		// stopwords keep their place, so "bank of america" needs one word between
+		{`"bank of america"`, []string{"Bank of America"}},
+		{`"bank in america"`, []string{"Bank of America"}},
+		{`"green plant"`, []string{"Green plant"}},
+		{`"plant green"`, nil},
+		{`"plant is green"`, []string{"Plant pigments"}},
+		{`"central bank"`, []string{"America"}},
+		{`"of the"`, nil}, // all stopwords, nothing to match
+		{`plant NEAR/1 green`, []string{"Green plant"}},
+		{`plant NEAR/2 green`, []string{"Green plant", "Plant pigments"}},
+		{`bank NEAR/1 america`, nil},
+		{`bank NEAR/2 america`, []string{"Bank of America"}},
+		{`bank NEAR/4 america`, []string{"America", "Bank of America"}},
+		{`"green plant" -light`, nil},
+	}
+	for _, tt := range tests {
+		got := searchTitles(t, e, tt.q)
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s results = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestPhraseQueriesWithoutPositions(t *testing.T) {
+	// an index built without -positions matches the docs having every word
+	e := newTestEngine(t, testIndex{pages: phrasePages})
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{`"green plant"`, []string{"Green plant", "Plant pigments"}},
+		{`"plant green"`, []string{"Green plant", "Plant pigments"}},
+		{`plant NEAR/1 green`, []string{"Green plant", "Plant pigments"}},
+		{`"central bank"`, []string{"America"}},
+	}
+	for _, tt := range tests {
+		got := searchTitles(t, e, tt.q)
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s results = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestWithinDistance(t *testing.T) {
+	tests := []struct {
+		a, b     []uint32
+		distance uint32
+		want     bool
+	}{
+		{[]uint32{1}, []uint32{2}, 1, true},
+		{[]uint32{2}, []uint32{1}, 1, true},
+		{[]uint32{1}, []uint32{3}, 1, false},
+		{[]uint32{1, 20}, []uint32{10, 22}, 2, true},
+		{[]uint32{1, 20}, []uint32{10, 30}, 5, false},
+		{[]uint32{5}, []uint32{5}, 0, true},
+		{nil, []uint32{1}, 10, false},
+	}
+	for _, tt := range tests {
+		if got := withinDistance(tt.a, tt.b, tt.distance); got != tt.want {
+			t.Errorf("withinDistance(%v, %v, %d) = %t, want %t", tt.a, tt.b, tt.distance, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"math"
+
+	"github.com/samiam2013/wiki4dummies/index"
+)
+
+// ranker scores how much one posting, a word's frequency in one field of a
+// doc, contributes to that doc's score for a query.
+type ranker interface {
+	score(field index.Field, freq, docLen uint32, docFreq int) float64
+}
+
+const ExactMatchMultiplier = 3
+const TitleMatchMultiplier = 10
+
+// legacyFieldMultipliers scale each field's word frequency, titles and
+// redirect titles count the most.
+var legacyFieldMultipliers = map[index.Field]uint32{
+	index.FieldExact:        ExactMatchMultiplier,
+	index.FieldStemmed:      1,
+	index.FieldAlias:        TitleMatchMultiplier,
+	index.FieldTitle:        TitleMatchMultiplier,
+	index.FieldTitleStemmed: TitleMatchMultiplier / ExactMatchMultiplier,
+}
+
+// legacyRanker is the original scoring, exact word matches count three times
+// as much as stemmed ones and nothing is normalized.
+type legacyRanker struct{}
+
+func (legacyRanker) score(field index.Field, freq, _ uint32, _ int) float64 {
+	return float64(legacyFieldMultipliers[field] * freq)
+}
+
+// bm25Ranker is Okapi BM25, k1 controls how quickly repeated words stop
+// adding to the score and b how much long docs are penalized. Each field's
+// score is scaled by its weight, a stemmed match is a weaker signal than the
+// word itself.
+type bm25Ranker struct {
+	k1, b        float64
+	fieldWeights map[index.Field]float64
+	numDocs      int
+	avgDocLen    float64
+}
+
+// bm25Weights are how much a match in each kind of field counts relative to
+// an exact match in the page's text.
+type bm25Weights struct {
+	stem, alias, title float64
+}
+
+// newBM25Ranker counts and averages the lengths of the live docs, leaving out
+// the superseded ones and tombstones.
+func newBM25Ranker(k1, b float64, weights bm25Weights, tokenCounts []uint32, superseded docSet) bm25Ranker {
+	var total uint64
+	numDocs := 0
+	for docID, c := range tokenCounts {
+		if _, ok := superseded[uint32(docID)]; ok {
+			continue
+		}
+		total += uint64(c)
+		numDocs++
+	}
+	avgDocLen := 1.0
+	if numDocs > 0 && total > 0 {
+		avgDocLen = float64(total) / float64(numDocs)
+	}
+	return bm25Ranker{
+		k1: k1,
+		b:  b,
+		fieldWeights: map[index.Field]float64{
+			index.FieldExact:        1,
+			index.FieldStemmed:      weights.stem,
+			index.FieldAlias:        weights.alias,
+			index.FieldTitle:        weights.title,
+			index.FieldTitleStemmed: weights.title * weights.stem,
+		},
+		numDocs:   numDocs,
+		avgDocLen: avgDocLen,
+	}
+}
+
+func (r bm25Ranker) score(field index.Field, freq, docLen uint32, docFreq int) float64 {
+	n := float64(docFreq)
+	idf := math.Log(1 + (float64(r.numDocs)-n+0.5)/(n+0.5))
+	tf := float64(freq)
+	b := r.b
+	switch field {
+	case index.FieldAlias, index.FieldTitle, index.FieldTitleStemmed:
+		// titles are a handful of words whatever the page's length
+		b = 0
+	}
+	norm := r.k1 * (1 - b + b*float64(docLen)/r.avgDocLen)
+	return r.fieldWeights[field] * idf * tf * (r.k1 + 1) / (tf + norm)
+}
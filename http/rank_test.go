@@ -0,0 +1,140 @@
+package main
+
+import (
+	"math"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/samiam2013/wiki4dummies/index"
+)
+
+func TestBM25Score(t *testing.T) {
+	// ten docs averaging 100 words
+	tokenCounts := []uint32{100, 100, 100, 100, 100, 50, 150, 100, 100, 100}
+	r := newBM25Ranker(1.2, 0.75, bm25Weights{stem: 0.5, alias: 3, title: 3}, tokenCounts, nil)
+	score := func(field index.Field, freq, docLen uint32, docFreq int) float64 {
+		return r.score(field, freq, docLen, docFreq)
+	}
+
+	if rare, common := score(index.FieldExact, 1, 100, 1), score(index.FieldExact, 1, 100, 9); rare <= common {
+		t.Errorf("a rare word scores %f, no more than a common one's %f", rare, common)
+	}
+	if score(index.FieldExact, 1, 100, 10) <= 0 {
+		t.Error("a word in every doc doesn't score")
+	}
+	if short, long := score(index.FieldExact, 2, 50, 3), score(index.FieldExact, 2, 150, 3); short <= long {
+		t.Errorf("a short doc scores %f, no more than a long one's %f", short, long)
+	}
+
+	// repeats add less and less, never past k1 + 1 times the idf, which is
+	// what a single match in a doc of average length scores
+	var prev, gain float64
+	for freq := uint32(1); freq <= 50; freq++ {
+		s := score(index.FieldExact, freq, 100, 3)
+		if freq > 1 && (s <= prev || (freq > 2 && s-prev >= gain)) {
+			t.Fatalf("score of %d repeats = %f after %f", freq, s, prev)
+		}
+		gain, prev = s-prev, s
+	}
+	if limit := 2.2 * score(index.FieldExact, 1, 100, 3); prev >= limit {
+		t.Errorf("50 repeats score %f, past %f", prev, limit)
+	}
+
+	exact := score(index.FieldExact, 1, 100, 3)
+	if stemmed := score(index.FieldStemmed, 1, 100, 3); stemmed != exact*0.5 {
+		t.Errorf("stemmed match = %f, want half of %f", stemmed, exact)
+	}
+	// titles aren't normalized by the page's length
+	if short, long := score(index.FieldTitle, 1, 50, 3), score(index.FieldTitle, 1, 150, 3); short != long {
+		t.Errorf("title match in a short doc = %f, in a long one %f", short, long)
+	}
+}
+
+func TestBM25LiveDocs(t *testing.T) {
+	// two live docs of 100 words, a superseded one and a tombstone
+	tokenCounts := []uint32{100, 1000, 100, 0}
+	r := newBM25Ranker(1.2, 0.75, bm25Weights{stem: 0.5, alias: 3, title: 3}, tokenCounts, docSet{1: {}, 3: {}})
+	if r.numDocs != 2 || r.avgDocLen != 100 {
+		t.Errorf("numDocs = %d, avgDocLen = %g, want 2 and 100", r.numDocs, r.avgDocLen)
+	}
+}
+
+func TestBM25Ranking(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: []testPage{
+		{title: "Garden", text: "A garden has a fern, roses, tulips, hedges, paths, benches, ponds and lawns."},
+		{title: "Fern", text: "A fern is a plant. Every fern reproduces by spores."},
+		{title: "Moss", text: "Moss is a plant that grows on rocks, often beside a fern."},
+		{title: "Forest", text: "A forest is mostly trees, a plant kind that is tall."},
+	}})
+	// the title and the repeats put Fern first, Moss is shorter than Garden
+	if got, want := searchTitles(t, e, "fern"), []string{"Fern", "Moss", "Garden"}; !slices.Equal(got, want) {
+		t.Errorf("fern results = %v, want %v", got, want)
+	}
+	// rare words count for more, only Fern has spores
+	if got := searchTitles(t, e, "plant spores"); len(got) != 3 || got[0] != "Fern" {
+		t.Errorf("plant spores results = %v, want Fern first of 3", got)
+	}
+
+	resp := runSearch(t, e, url.Values{"q": {"fern"}, "limit": {"1"}})
+	var sum float64
+	for _, c := range resp.Results[0].Breakdown {
+		sum += c.Score
+	}
+	if len(resp.Results[0].Breakdown) == 0 || math.Abs(sum-resp.Results[0].Score) > 1e-9 {
+		t.Errorf("breakdown %v doesn't add up to the score %f", resp.Results[0].Breakdown, resp.Results[0].Score)
+	}
+}
+
+func TestTitleBoost(t *testing.T) {
+	pages := []testPage{
+		{title: "Gardening", text: "Tulips are grown from bulbs. Tulips flower in spring, tulips come in many colours."},
+		{title: "Tulip", text: "A spring flower grown from bulbs."},
+		{title: "Netherlands", text: "A country known for tulips and windmills."},
+	}
+	e := newTestEngine(t, testIndex{pages: pages})
+	if got := searchTitles(t, e, "tulip"); len(got) != 3 || got[0] != "Tulip" {
+		t.Errorf("tulip results = %v, want Tulip first of 3", got)
+	}
+	if got := searchTitles(t, e, "intitle:tulip"); !slices.Equal(got, []string{"Tulip"}) {
+		t.Errorf("intitle:tulip results = %v, want [Tulip]", got)
+	}
+	if got := searchTitles(t, e, "intitle:tulips"); !slices.Equal(got, []string{"Tulip"}) {
+		t.Errorf("intitle:tulips results = %v, want the stemmed match [Tulip]", got)
+	}
+	if got := searchTitles(t, e, "intitle:bulbs"); len(got) != 0 {
+		t.Errorf("intitle:bulbs results = %v, want none", got)
+	}
+
+	// without the boost the title is one more mention
+	e.rankers["bm25"] = newBM25Ranker(1.2, 0.75, bm25Weights{stem: 0.5, alias: 3, title: 0}, e.tokenCounts, e.superseded)
+	if got := searchTitles(t, e, "tulip"); len(got) != 3 || got[0] != "Gardening" {
+		t.Errorf("tulip results without a title weight = %v, want Gardening first of 3", got)
+	}
+}
+
+func TestPriorBoost(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: []testPage{
+		{title: "Oak", text: "An oak is a tree with acorns."},
+		{title: "Maple", text: "A maple is a tree with sap."},
+	}})
+	if got := searchTitles(t, e, "tree"); len(got) != 2 || got[0] != "Oak" {
+		t.Fatalf("tree results = %v, want Oak first of 2", got)
+	}
+	// the widely linked to Maple goes first
+	e.priors = []float32{0.1, 1}
+	e.priorWeight = 1
+	resp := runSearch(t, e, url.Values{"q": {"tree"}})
+	if len(resp.Results) != 2 || resp.Results[0].Title != "Maple" {
+		t.Fatalf("tree results with priors = %v, want Maple first of 2", resp.Results)
+	}
+	breakdown := resp.Results[0].Breakdown
+	if last := breakdown[len(breakdown)-1]; last.Field != "prior" || last.Score != 1 {
+		t.Errorf("Maple's breakdown %v doesn't end with its prior", breakdown)
+	}
+	// a weight of 0 turns priors off
+	e.priorWeight = 0
+	if got := searchTitles(t, e, "tree"); len(got) != 2 || got[0] != "Oak" {
+		t.Errorf("tree results with priors off = %v, want Oak first of 2", got)
+	}
+}
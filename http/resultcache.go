@@ -1,29 +1,145 @@
 package main
 
 import (
+	"container/list"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// resultCache is an LRU of search responses bounded by both entry count and
+// approximate size in bytes. Entries also expire after a TTL, swept by a
+// single janitor goroutine.
 type resultCache struct {
-	*sync.Map
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // front is the most recently used
+	bytes      int
+	maxEntries int
+	maxBytes   int
+	ttl        time.Duration
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	stop   chan struct{}
+}
+
+type cacheEntry struct {
+	key     string
+	val     SearchResponse
+	size    int
+	expires time.Time
 }
 
-func newResultCache() *resultCache {
-	return &resultCache{&sync.Map{}}
+func newResultCache(maxEntries, maxBytes int, ttl time.Duration) *resultCache {
+	rc := &resultCache{
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ttl:        ttl,
+		stop:       make(chan struct{}),
+	}
+	go rc.janitor()
+	return rc
+}
+
+// janitor drops expired entries so they don't hold memory until evicted.
+func (rc *resultCache) janitor() {
+	t := time.NewTicker(max(rc.ttl/2, time.Second))
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			rc.removeExpired(time.Now())
+		case <-rc.stop:
+			return
+		}
+	}
 }
 
-func (rc *resultCache) get(key string) (SearchPageData, bool) {
-	val, ok := rc.Load(key)
-	if !ok {
-		return SearchPageData{}, false
+func (rc *resultCache) removeExpired(now time.Time) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	// expiry isn't in LRU order, a hit doesn't extend it
+	for el := rc.lru.Front(); el != nil; {
+		next := el.Next()
+		if now.After(el.Value.(*cacheEntry).expires) {
+			rc.remove(el)
+		}
+		el = next
 	}
-	return val.(SearchPageData), true
 }
 
-func (rc *resultCache) set(key string, val SearchPageData, dur time.Duration) {
-	rc.Store(key, val)
-	_ = time.AfterFunc(dur, func() {
-		rc.Delete(key)
-	})
+func (rc *resultCache) close() {
+	close(rc.stop)
+}
+
+func (rc *resultCache) get(key string) (SearchResponse, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	el, ok := rc.entries[key]
+	if !ok || time.Now().After(el.Value.(*cacheEntry).expires) {
+		rc.misses.Add(1)
+		return SearchResponse{}, false
+	}
+	rc.hits.Add(1)
+	rc.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry).val, true
+}
+
+func (rc *resultCache) set(key string, val SearchResponse) {
+	size := responseSize(val)
+	if size > rc.maxBytes {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if el, ok := rc.entries[key]; ok {
+		rc.remove(el)
+	}
+	entry := &cacheEntry{key: key, val: val, size: size, expires: time.Now().Add(rc.ttl)}
+	rc.entries[key] = rc.lru.PushFront(entry)
+	rc.bytes += size
+	for len(rc.entries) > rc.maxEntries || rc.bytes > rc.maxBytes {
+		rc.remove(rc.lru.Back())
+	}
+}
+
+func (rc *resultCache) remove(el *list.Element) {
+	entry := rc.lru.Remove(el).(*cacheEntry)
+	delete(rc.entries, entry.key)
+	rc.bytes -= entry.size
+}
+
+type cacheStats struct {
+	Entries int    `json:"entries"`
+	Bytes   int    `json:"bytes"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+func (rc *resultCache) stats() cacheStats {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return cacheStats{
+		Entries: len(rc.entries),
+		Bytes:   rc.bytes,
+		Hits:    rc.hits.Load(),
+		Misses:  rc.misses.Load(),
+	}
+}
+
+// responseSize roughly estimates the memory a response holds, its strings
+// plus a fixed overhead per value.
+func responseSize(resp SearchResponse) int {
+	const overhead = 64
+	size := overhead + len(resp.Query)
+	for _, r := range resp.Results {
+		size += overhead + len(r.Title) + len(r.URL) + len(r.Snippet) + len(r.Abstract)
+		for _, c := range r.Breakdown {
+			size += overhead + len(c.Word) + len(c.Field)
+		}
+	}
+	return size
 }
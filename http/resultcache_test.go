@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func cachedResponse(query string, abstractLen int) SearchResponse {
+	return SearchResponse{
+		Query:   query,
+		Results: []SearchResult{{Title: query, Abstract: strings.Repeat("a", abstractLen)}},
+	}
+}
+
+func TestResultCacheEvictsByEntries(t *testing.T) {
+	rc := newResultCache(2, 1<<20, time.Minute)
+	defer rc.close()
+	rc.set("a", cachedResponse("a", 0))
+	rc.set("b", cachedResponse("b", 0))
+	if _, ok := rc.get("a"); !ok { // a is now the most recently used
+		t.Fatal("a missing")
+	}
+	rc.set("c", cachedResponse("c", 0))
+	if _, ok := rc.get("b"); ok {
+		t.Error("b, the least recently used, wasn't evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if got, ok := rc.get(key); !ok || got.Query != key {
+			t.Errorf("get(%s) = %q, %t", key, got.Query, ok)
+		}
+	}
+	if st := rc.stats(); st.Entries != 2 {
+		t.Errorf("%d entries, want 2", st.Entries)
+	}
+}
+
+func TestResultCacheEvictsByBytes(t *testing.T) {
+	size := responseSize(cachedResponse("a", 1000))
+	rc := newResultCache(100, 2*size+size/2, time.Minute)
+	defer rc.close()
+	for _, key := range []string{"a", "b", "c"} {
+		rc.set(key, cachedResponse(key, 1000))
+	}
+	if _, ok := rc.get("a"); ok {
+		t.Error("a wasn't evicted to make room")
+	}
+	if st := rc.stats(); st.Entries != 2 || st.Bytes != 2*size {
+		t.Errorf("stats = %+v, want 2 entries of %d bytes", st, 2*size)
+	}
+
+	// replacing an entry doesn't count its old size twice
+	rc.set("c", cachedResponse("c", 1000))
+	if st := rc.stats(); st.Entries != 2 || st.Bytes != 2*size {
+		t.Errorf("after replacing, stats = %+v, want 2 entries of %d bytes", st, 2*size)
+	}
+
+	// a response bigger than the whole cache isn't cached, nor does it evict
+	rc.set("huge", cachedResponse("huge", 3*size))
+	if _, ok := rc.get("huge"); ok {
+		t.Error("huge response was cached")
+	}
+	if st := rc.stats(); st.Entries != 2 {
+		t.Errorf("%d entries after the huge response, want 2", st.Entries)
+	}
+}
+
+func TestResultCacheExpiry(t *testing.T) {
+	rc := newResultCache(10, 1<<20, time.Minute)
+	defer rc.close()
+	rc.set("a", cachedResponse("a", 0))
+	rc.set("b", cachedResponse("b", 0))
+	rc.mu.Lock()
+	rc.entries["a"].Value.(*cacheEntry).expires = time.Now().Add(-time.Second)
+	rc.mu.Unlock()
+
+	if _, ok := rc.get("a"); ok {
+		t.Error("expired entry returned")
+	}
+	rc.removeExpired(time.Now())
+	if st := rc.stats(); st.Entries != 1 || st.Bytes != responseSize(cachedResponse("b", 0)) {
+		t.Errorf("stats = %+v, want only b", st)
+	}
+}
+
+func TestResultCacheJanitor(t *testing.T) {
+	rc := newResultCache(10, 1<<20, time.Millisecond)
+	defer rc.close()
+	rc.set("a", cachedResponse("a", 0))
+	deadline := time.Now().Add(5 * time.Second)
+	for rc.stats().Entries != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("janitor never removed the expired entry")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := rc.stats(); st.Bytes != 0 {
+		t.Errorf("%d bytes left, want 0", st.Bytes)
+	}
+}
+
+func TestResultCacheCounters(t *testing.T) {
+	rc := newResultCache(10, 1<<20, time.Minute)
+	defer rc.close()
+	rc.get("a")
+	rc.set("a", cachedResponse("a", 0))
+	rc.get("a")
+	rc.get("a")
+	rc.get("b")
+	if st := rc.stats(); st.Hits != 2 || st.Misses != 2 {
+		t.Errorf("hits %d, misses %d, want 2 and 2", st.Hits, st.Misses)
+	}
+}
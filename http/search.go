@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/query"
+	"github.com/samiam2013/wiki4dummies/wiki"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxLimit caps how many results can be asked for at once.
+const maxLimit = 100
+
+// rescoreWindow is how many of the top pages the legacy ranker reads to
+// rescore by their text.
+const rescoreWindow = 100
+
+// searchRequest is a parsed query and its settings from the URL.
+type searchRequest struct {
+	q        string
+	root     query.Node
+	rankName string
+	stem     bool // also match words sharing a stem with the query's
+	offset   int
+	limit    int
+}
+
+// parseSearchRequest reads the q, rank, stem, offset and limit parameters.
+// Every error is the client's fault.
+func parseSearchRequest(e *engine, r *http.Request, defaultLimit int) (searchRequest, error) {
+	params := r.URL.Query()
+	req := searchRequest{q: params.Get("q"), rankName: params.Get("rank"), stem: true, limit: defaultLimit}
+	if strings.TrimSpace(req.q) == "" {
+		return searchRequest{}, errors.New("no query provided")
+	}
+	if req.rankName == "" {
+		req.rankName = e.defaultRanker
+	}
+	if _, ok := e.rankers[req.rankName]; !ok {
+		return searchRequest{}, errors.New("unknown ranker")
+	}
+	switch params.Get("stem") {
+	case "", "on":
+	case "off":
+		req.stem = false
+	default:
+		return searchRequest{}, errors.New("stem must be on or off")
+	}
+	if s := params.Get("offset"); s != "" {
+		offset, err := strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return searchRequest{}, errors.New("offset must be a non-negative number")
+		}
+		req.offset = offset
+	}
+	if s := params.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return searchRequest{}, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		req.limit = limit
+	}
+	root, err := query.Parse(req.q)
+	if err != nil {
+		return searchRequest{}, err
+	}
+	for _, name := range query.Namespaces(root) {
+		if _, err := e.namespaceKey(name); err != nil {
+			return searchRequest{}, err
+		}
+	}
+	req.root = root
+	return req, nil
+}
+
+// cacheKey identifies a page of results for a search, by its normalized
+// query so "Plant" and "plant " share an entry.
+func cacheKey(req searchRequest) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%t\x00%d\x00%d",
+		query.Canonical(req.root), req.rankName, req.stem, req.offset, req.limit)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// cachedSearch answers from the cache when the same search was run recently,
+// timed as this request and flagged as cached. It also returns the cache key,
+// which the AI summary looks the results up by.
+func cachedSearch(e *engine, cache *resultCache, req searchRequest) (SearchResponse, string, error) {
+	startTime := time.Now()
+	key := cacheKey(req)
+	if resp, ok := cache.get(key); ok {
+		resp.Cached = true
+		resp.setTook(startTime)
+		return resp, key, nil
+	}
+	resp, err := search(e, req)
+	if err != nil {
+		return SearchResponse{}, "", err
+	}
+	cache.set(key, resp)
+	return resp, key, nil
+}
+
+// SearchResponse is one page of results for a query. Pages are cut from the
+// same ordering, by score with ties broken by doc ID, so paging through a
+// query never repeats or skips a result.
+type SearchResponse struct {
+	Query     string         `json:"query"`
+	Took      time.Duration  `json:"-"`
+	TookMS    float64        `json:"took_ms"`
+	Cached    bool           `json:"cached"`
+	TotalHits int            `json:"total_hits"`
+	Offset    int            `json:"offset"`
+	Limit     int            `json:"limit"`
+	Results   []SearchResult `json:"results"`
+}
+
+type SearchResult struct {
+	Title     string           `json:"title"`
+	URL       string           `json:"url"`
+	Snippet   string           `json:"snippet"`
+	Abstract  string           `json:"abstract"` // used for AI generated answers
+	Score     float64          `json:"score"`
+	Breakdown []ScoreComponent `json:"breakdown"`
+}
+
+// ScoreComponent is what one word matching in one field added to a result's
+// score. The PageRank prior and the legacy ranker's rescoring by page text
+// have no word.
+type ScoreComponent struct {
+	Word  string  `json:"word,omitempty"`
+	Field string  `json:"field"`
+	Score float64 `json:"score"`
+}
+
+func search(e *engine, req searchRequest) (SearchResponse, error) {
+	fmt.Printf("Searching for: %s\n", req.q)
+	startTime := time.Now()
+	rank := e.rankers[req.rankName]
+	// Search the index
+	indexPath := filepath.Join(e.savePath, constants.IndexFileFolder)
+	words := query.Terms(req.root)
+
+	loadIndexStart := time.Now()
+	postings := newPostingCache(indexPath)
+	// only articles are searched unless the query says which namespaces
+	root := req.root
+	if len(query.Namespaces(root)) == 0 {
+		root = query.And{Children: []query.Node{root, query.InNamespace{Name: "0"}}}
+	}
+	matched, err := evaluate(e, postings, root, req.stem)
+	if err != nil {
+		return SearchResponse{}, err
+	}
+	// every match is a result, even if the query only filters, like
+	// incategory: on its own
+	pages := make(map[uint32]float64, len(matched))
+	for docID := range matched {
+		pages[docID] = 0
+	}
+	err = scoreWords(e, rank, postings, words, req.stem, matched,
+		func(docID uint32, _ string, _ index.Field, score float64) {
+			pages[docID] += score
+		})
+	if err != nil {
+		return SearchResponse{}, err
+	}
+	for docID := range pages {
+		pages[docID] += e.prior(docID)
+	}
+	fmt.Printf("Loaded indexes in %s\n", time.Since(loadIndexStart).String())
+
+	sortSliceTime := time.Now()
+	type match struct {
+		docID      uint32
+		doc        index.Doc
+		indexScore float64
+		textScore  int
+	}
+	// sort the pages by index score, doc ID keeps ties in a stable order
+	ranked := make([]match, 0, len(pages))
+	for docID, score := range pages {
+		ranked = append(ranked, match{docID: docID, indexScore: score})
+	}
+	slices.SortFunc(ranked, func(a, b match) int {
+		if c := cmp.Compare(b.indexScore, a.indexScore); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.docID, b.docID)
+	})
+	fmt.Printf("Sorted pages in %s\n", time.Since(sortSliceTime).String())
+
+	// the legacy ranker searches the page files of the top pages for the
+	// query and reorders them
+	startScorePages := time.Now()
+	if _, ok := rank.(legacyRanker); ok {
+		window := ranked[:min(len(ranked), rescoreWindow)]
+		eg := errgroup.Group{}
+		for i := range window {
+			eg.Go(func() error {
+				m := &window[i]
+				doc, err := e.docs.Get(m.docID)
+				if err != nil {
+					return fmt.Errorf("failed to get doc: %w", err)
+				}
+				m.doc = doc
+				pagePath := filepath.Join(e.savePath, constants.PageFileFolder, doc.RelPath)
+				textScore, err := scorePageMatch(pagePath, words)
+				if err != nil {
+					return fmt.Errorf("failed to score page match: %w", err)
+				}
+				m.textScore = textScore
+				return nil
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			return SearchResponse{}, fmt.Errorf("failed page search(es): %w", err)
+		}
+		slices.SortStableFunc(window, func(a, b match) int {
+			return cmp.Compare(b.indexScore+float64(b.textScore), a.indexScore+float64(a.textScore))
+		})
+	}
+	fmt.Printf("Scored pages in %s\n", time.Since(startScorePages).String())
+
+	startGetPageData := time.Now()
+	matchList := ranked[min(len(ranked), req.offset):min(len(ranked), req.offset+req.limit)]
+	eg := errgroup.Group{}
+	for i := range matchList {
+		if matchList[i].doc.Title != "" {
+			continue
+		}
+		eg.Go(func() error {
+			doc, err := e.docs.Get(matchList[i].docID)
+			if err != nil {
+				return fmt.Errorf("failed to get doc: %w", err)
+			}
+			matchList[i].doc = doc
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return SearchResponse{}, err
+	}
+
+	// break the scores of just this page of results down by word and field
+	breakdowns := make(map[uint32][]ScoreComponent, len(matchList))
+	for _, m := range matchList {
+		breakdowns[m.docID] = nil
+	}
+	err = scoreWords(e, rank, postings, words, req.stem, matched,
+		func(docID uint32, word string, field index.Field, score float64) {
+			if bd, ok := breakdowns[docID]; ok {
+				breakdowns[docID] = append(bd, ScoreComponent{Word: word, Field: field.String(), Score: score})
+			}
+		})
+	if err != nil {
+		return SearchResponse{}, err
+	}
+
+	resp := SearchResponse{
+		Query:     req.q,
+		TotalHits: len(pages),
+		Offset:    req.offset,
+		Limit:     req.limit,
+		Results:   make([]SearchResult, 0, len(matchList)),
+	}
+	for _, m := range matchList {
+		sr := SearchResult{
+			Title:     m.doc.Title,
+			Abstract:  m.doc.Abstract,
+			URL:       fmt.Sprintf("/page/%s", m.doc.RelPath),
+			Snippet:   m.doc.Abstract,
+			Score:     m.indexScore + float64(m.textScore),
+			Breakdown: breakdowns[m.docID],
+		}
+		if prior := e.prior(m.docID); prior != 0 {
+			sr.Breakdown = append(sr.Breakdown, ScoreComponent{Field: "prior", Score: prior})
+		}
+		if m.textScore != 0 {
+			sr.Breakdown = append(sr.Breakdown, ScoreComponent{Field: "page_text", Score: float64(m.textScore)})
+		}
+		sr.Snippet = truncateSnippet(sr.Snippet, snippetMaxLen)
+		resp.Results = append(resp.Results, sr)
+	}
+	fmt.Printf("Got page data in %s\n", time.Since(startGetPageData).String())
+
+	resp.setTook(startTime)
+	return resp, nil
+}
+
+func (r *SearchResponse) setTook(startTime time.Time) {
+	r.Took = time.Since(startTime)
+	r.TookMS = float64(r.Took.Microseconds()) / 1000
+}
+
+const snippetMaxLen = 300
+
+// truncateSnippet cuts s to at most maxLen bytes plus an ellipsis, at the last
+// space if there is one and otherwise at the last whole rune.
+func truncateSnippet(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	cut := maxLen
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	s = s[:cut]
+	if lastSpace := strings.LastIndex(s, " "); lastSpace > 0 {
+		s = s[:lastSpace]
+	}
+	return s + "..."
+}
+
+// scoreWords calls fn with the score of each posting of the query's words in
+// the matched docs.
+func scoreWords(e *engine, rank ranker, postings *postingCache, words []string, stem bool,
+	matched docSet, fn func(docID uint32, word string, field index.Field, score float64)) error {
+	for _, word := range words {
+		if _, ok := wiki.FrequentWords[word]; ok {
+			continue
+		}
+		lists, err := postings.wordLists(word, stem)
+		if err != nil {
+			return err
+		}
+		for _, l := range lists {
+			for l.it.Next() {
+				docID := l.it.DocID()
+				if _, ok := matched[docID]; !ok {
+					continue
+				}
+				fn(docID, word, l.field, rank.score(l.field, l.it.Freq(), e.tokenCounts[docID], l.it.Len()))
+			}
+			if err := l.it.Err(); err != nil {
+				return fmt.Errorf("failed to read postings for %s: %w", word, err)
+			}
+		}
+	}
+	return nil
+}
+
+func scorePageMatch(pagePath string, words []string) (int, error) {
+	f, err := os.Open(pagePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open page file: %w", err)
+	}
+	defer f.Close()
+	var matches int
+	// scan over each line and count the number of times the words appear
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.ToLower(sc.Text())
+		for _, word := range words {
+			matches += strings.Count(line, word)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return 0, fmt.Errorf("failed to scan page file: %w", err)
+	}
+	return matches, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestCachedSearchTook(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: apiPages})
+	cache := newResultCache(10, 1<<20, time.Minute)
+	defer cache.close()
+	req, err := parseSearchRequest(e, httptest.NewRequest("GET", "/search?q=plant", nil), defaultPageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a search that took an hour when it was cached
+	cache.set(cacheKey(req), SearchResponse{Query: "plant", Took: time.Hour, TookMS: 3600000})
+	resp, _, err := cachedSearch(e, cache, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Cached || resp.Took >= time.Hour || resp.TookMS >= 3600000 {
+		t.Errorf("cached response took %s (%gms), cached %t, want this request's time", resp.Took, resp.TookMS, resp.Cached)
+	}
+}
+
+func TestTruncateSnippet(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"short", "Plants", "Plants"},
+		{"exactly max", "Plants are", "Plants are"},
+		{"at a space", "Plants are eukaryotes", "Plants..."},
+		{"no space", "Photosynthesis", "Photosynth..."},
+		{"leading space only", " Photosynthesis", " Photosynt..."},
+		{"wide runes", "日本語の植物", "日本語..."},
+		{"inside a rune", "Photosyntöl", "Photosynt..."},
+		{"inside a rune after a space", "Ein Baumköl", "Ein..."},
+	}
+	for _, tt := range tests {
+		if got := truncateSnippet(tt.s, 10); got != tt.want {
+			t.Errorf("%s: truncateSnippet(%q) = %q, want %q", tt.name, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateSnippetAlwaysValid(t *testing.T) {
+	s := strings.Repeat("ö", snippetMaxLen)
+	for maxLen := range 8 {
+		got := truncateSnippet(s, maxLen)
+		if !utf8.ValidString(got) || len(got) > maxLen+len("...") {
+			t.Errorf("truncateSnippet(%d) = %q", maxLen, got)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// maxSummarySources is how many of the top results the summary is grounded
+// in.
+const maxSummarySources = 5
+
+// summaryPrompt asks the model to answer only from the numbered abstracts and
+// to cite them by title.
+func summaryPrompt(q string, results []SearchResult) string {
+	var b strings.Builder
+	b.WriteString("Answer the question using only the Wikipedia abstracts below. ")
+	b.WriteString("Cite the title of every abstract you use in square brackets, like [Title]. ")
+	b.WriteString("If the abstracts don't answer the question, say so.\n\n")
+	for i, r := range results[:min(len(results), maxSummarySources)] {
+		fmt.Fprintf(&b, "%d. %s\n%s\n\n", i+1, r.Title, r.Abstract)
+	}
+	fmt.Fprintf(&b, "Question: %s\nAnswer:", q)
+	return b.String()
+}
+
+// writeEvent sends a server-sent event. The results page adds message data
+// to the page as HTML, so it has to be escaped already.
+func writeEvent(w http.ResponseWriter, event, data string) error {
+	if event != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+	for _, line := range strings.Split(data, "\n") {
+		if _, err := fmt.Fprintf(w, "data: %s\n", line); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprint(w, "\n"); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// handleAISummary streams an answer to a cached search's query, grounded in
+// its results' abstracts, followed by links to the results it drew on.
+func handleAISummary(cache *resultCache, ollama *ollamaClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, ok := cache.get(r.URL.Query().Get("cache_key"))
+		if !ok {
+			http.Error(w, "Search results expired, search again", http.StatusNotFound)
+			return
+		}
+		if len(data.Results) == 0 {
+			http.Error(w, "No results to summarize", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		err := ollama.generate(r.Context(), summaryPrompt(data.Query, data.Results), func(text string) error {
+			html := strings.ReplaceAll(template.HTMLEscapeString(text), "\n", "<br>")
+			return writeEvent(w, "", html)
+		})
+		if err != nil {
+			fmt.Printf("Failed to generate summary: %v\n", err)
+			_ = writeEvent(w, "", "<br><em>The summary failed.</em>")
+			_ = writeEvent(w, "end", "")
+			return
+		}
+
+		var sources strings.Builder
+		sources.WriteString("<br><br>Sources: ")
+		for i, res := range data.Results[:min(len(data.Results), maxSummarySources)] {
+			if i > 0 {
+				sources.WriteString(", ")
+			}
+			fmt.Fprintf(&sources, `<a href="%s">%s</a>`,
+				template.HTMLEscapeString(res.URL), template.HTMLEscapeString(res.Title))
+		}
+		_ = writeEvent(w, "", sources.String())
+		_ = writeEvent(w, "end", "")
+	}
+}
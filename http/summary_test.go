@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubOllama serves /api/generate with handle, after checking the request is
+// a streaming one for the test model.
+func stubOllama(t *testing.T, handle func(w http.ResponseWriter, r *http.Request)) *ollamaClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req generateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode generate request: %v", err)
+		}
+		if r.URL.Path != "/api/generate" || req.Model != "test" || !req.Stream {
+			t.Errorf("got %s %+v, want a streaming /api/generate for test", r.URL.Path, req)
+		}
+		if !strings.Contains(req.Prompt, "1. Plant\nPlants are eukaryotes.") {
+			t.Errorf("prompt %q is missing the results' abstracts", req.Prompt)
+		}
+		handle(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return newOllamaClient(srv.URL+"/", "test")
+}
+
+// writeChunks streams generate chunks the way Ollama does, a JSON line each.
+func writeChunks(w http.ResponseWriter, chunks ...generateChunk) {
+	for _, c := range chunks {
+		b, _ := json.Marshal(c)
+		_, _ = fmt.Fprintf(w, "%s\n", b)
+		w.(http.Flusher).Flush()
+	}
+}
+
+// summaryServer serves handleAISummary for a cached search under the key k.
+func summaryServer(t *testing.T, ollama *ollamaClient) *httptest.Server {
+	t.Helper()
+	cache := newResultCache(10, 1<<20, time.Minute)
+	t.Cleanup(cache.close)
+	cache.set("k", SearchResponse{
+		Query: "what are plants",
+		Results: []SearchResult{
+			{Title: "Plant", URL: "/page/plant", Abstract: "Plants are eukaryotes."},
+			{Title: "Tom & Jerry", URL: "/page/tom_%26_jerry", Abstract: "A cartoon."},
+		},
+	})
+	srv := httptest.NewServer(handleAISummary(cache, ollama))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func getSummary(t *testing.T, srv *httptest.Server, key string) (*http.Response, string) {
+	t.Helper()
+	resp, err := http.Get(srv.URL + "?cache_key=" + key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+func TestAISummaryStreams(t *testing.T) {
+	ollama := stubOllama(t, func(w http.ResponseWriter, r *http.Request) {
+		writeChunks(w,
+			generateChunk{Response: "Plants are "},
+			generateChunk{Response: "<eukaryotes>\n[Plant]"},
+			generateChunk{Done: true},
+		)
+	})
+	resp, body := getSummary(t, summaryServer(t, ollama), "k")
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	want := "data: Plants are \n\n" +
+		"data: &lt;eukaryotes&gt;<br>[Plant]\n\n" +
+		`data: <br><br>Sources: <a href="/page/plant">Plant</a>, <a href="/page/tom_%26_jerry">Tom &amp; Jerry</a>` + "\n\n" +
+		"event: end\ndata: \n\n"
+	if body != want {
+		t.Errorf("events =\n%s\nwant\n%s", body, want)
+	}
+}
+
+func TestAISummaryUpstreamErrors(t *testing.T) {
+	const failed = "data: <br><em>The summary failed.</em>\n\nevent: end\ndata: \n\n"
+	tests := []struct {
+		name   string
+		handle func(w http.ResponseWriter, r *http.Request)
+		want   string
+	}{
+		{"status", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+		}, failed},
+		{"error chunk", func(w http.ResponseWriter, r *http.Request) {
+			writeChunks(w, generateChunk{Response: "Plants"}, generateChunk{Error: "out of memory"})
+		}, "data: Plants\n\n" + failed},
+		{"cut short", func(w http.ResponseWriter, r *http.Request) {
+			writeChunks(w, generateChunk{Response: "Plants"})
+		}, "data: Plants\n\n" + failed},
+		{"not json", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "<html>bad gateway</html>\n")
+		}, failed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := getSummary(t, summaryServer(t, stubOllama(t, tt.handle)), "k")
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("status = %d, want the stream's 200", resp.StatusCode)
+			}
+			if body != tt.want {
+				t.Errorf("events =\n%s\nwant\n%s", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestAISummaryExpiredSearch(t *testing.T) {
+	ollama := stubOllama(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("generate called without search results")
+	})
+	resp, _ := getSummary(t, summaryServer(t, ollama), "gone")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestAISummaryClientDisconnect(t *testing.T) {
+	canceled := make(chan struct{})
+	ollama := stubOllama(t, func(w http.ResponseWriter, r *http.Request) {
+		writeChunks(w, generateChunk{Response: "Plants"})
+		select {
+		case <-r.Context().Done():
+			close(canceled)
+		case <-time.After(5 * time.Second):
+		}
+	})
+	srv := summaryServer(t, ollama)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?cache_key=k", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "data: Plants\n" {
+		t.Fatalf("first event line = %q, %v", line, err)
+	}
+
+	// hanging up has to stop generating rather than leave the model running
+	cancel()
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("generate request not canceled after the client went away")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestSupersededDocsLeftOut(t *testing.T) {
+	e := newTestEngine(t, testIndex{pages: []testPage{
+		{title: "Fern", text: "A fern grows in damp soil."},
+		{title: "Moss", text: "Moss grows on rocks."},
+		{title: "Fern", text: "A fern grows in shade.", pageID: 1}, // Fern edited
+	}})
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"fern", []string{"Fern"}}, // once, the latest revision
+		{"soil", nil},              // only in the revision replaced
+		{"shade", []string{"Fern"}},
+		{"grows", []string{"Fern", "Moss"}},
+	}
+	for _, tt := range tests {
+		got := searchTitles(t, e, tt.q)
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s results = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+	resp := runSearch(t, e, url.Values{"q": {"fern"}})
+	if resp.TotalHits != 1 || resp.Results[0].Snippet != "A fern grows in shade." {
+		t.Errorf("fern response = %+v, want the edited Fern", resp)
+	}
+}
@@ -0,0 +1,124 @@
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// appendLog is an append-only file of Ts, a line of JSON each, that can be
+// rolled back to an earlier size.
+type appendLog[T any] struct {
+	name string // what's in the log, for errors
+	fh   *os.File
+	w    *bufio.Writer
+	size int64
+}
+
+func openAppendLog[T any](dir, fileName, name string) (*appendLog[T], error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s dir: %w", name, err)
+	}
+	fh, err := os.OpenFile(filepath.Join(dir, fileName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	size, err := fh.Seek(0, io.SeekEnd)
+	if err != nil {
+		_ = fh.Close()
+		return nil, fmt.Errorf("failed to seek %s: %w", name, err)
+	}
+	return &appendLog[T]{name: name, fh: fh, w: bufio.NewWriter(fh), size: size}, nil
+}
+
+// Append adds v to the log, buffered until Sync.
+func (l *appendLog[T]) Append(v T) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s entry: %w", l.name, err)
+	}
+	b = append(b, '\n')
+	if _, err := l.w.Write(b); err != nil {
+		return fmt.Errorf("failed to write %s entry: %w", l.name, err)
+	}
+	l.size += int64(len(b))
+	return nil
+}
+
+// Size is the length of the log in bytes, what to Truncate to when rolling
+// back to this point.
+func (l *appendLog[T]) Size() int64 {
+	return l.size
+}
+
+// Sync makes every appended entry durable.
+func (l *appendLog[T]) Sync() error {
+	if err := l.w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush %s: %w", l.name, err)
+	}
+	if err := l.fh.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", l.name, err)
+	}
+	return nil
+}
+
+// Truncate drops everything appended after the log was size bytes long.
+func (l *appendLog[T]) Truncate(size int64) error {
+	if err := l.w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush %s: %w", l.name, err)
+	}
+	if size > l.size {
+		return fmt.Errorf("can't truncate %d byte %s to %d", l.size, l.name, size)
+	}
+	if err := l.fh.Truncate(size); err != nil {
+		return fmt.Errorf("failed to truncate %s: %w", l.name, err)
+	}
+	if _, err := l.fh.Seek(size, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek %s: %w", l.name, err)
+	}
+	l.size = size
+	return nil
+}
+
+func (l *appendLog[T]) Close() error {
+	err := l.w.Flush()
+	if closeErr := l.fh.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// readAppendLog calls fn with every entry of the log at path, stopping at a
+// torn write after the last sync. A missing log is empty.
+func readAppendLog[T any](path, name string, fn func(T) error) error {
+	fh, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer func() { _ = fh.Close() }()
+	r := bufio.NewReaderSize(fh, 1024*1024)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// anything left is a torn write
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		var v T
+		if err := json.Unmarshal(line, &v); err != nil {
+			return fmt.Errorf("failed to unmarshal %s entry: %w", name, err)
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+}
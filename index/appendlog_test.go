@@ -0,0 +1,72 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppendLogRollback(t *testing.T) {
+	dir := t.TempDir()
+	rt, err := OpenRedirectTable(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Append(Redirect{From: "Ferns", To: "Fern"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint := rt.Size()
+	if err := rt.Truncate(checkpoint + 1); err == nil {
+		t.Error("truncated the table past its end")
+	}
+	if err := rt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash leaves half an entry past the checkpoint
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("redirect table dir has %v, %v", entries, err)
+	}
+	path := filepath.Join(dir, entries[0].Name())
+	fh, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fh.WriteString(`{"from":"Mos`); err != nil {
+		t.Fatal(err)
+	}
+	if err := fh.Close(); err != nil {
+		t.Fatal(err)
+	}
+	redirects, err := LoadRedirects(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(redirects) != 1 || redirects["Ferns"] != "Fern" {
+		t.Errorf("redirects with a torn write = %v, want only Ferns", redirects)
+	}
+
+	// resuming truncates it before appending more
+	if rt, err = OpenRedirectTable(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Truncate(checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Append(Redirect{From: "Mosses", To: "Moss"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if redirects, err = LoadRedirects(dir); err != nil {
+		t.Fatal(err)
+	}
+	if len(redirects) != 2 || redirects["Mosses"] != "Moss" {
+		t.Errorf("redirects after resuming = %v, want Ferns and Mosses", redirects)
+	}
+}
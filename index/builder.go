@@ -0,0 +1,215 @@
+package index
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type termField struct {
+	term  string
+	field Field
+}
+
+// Builder accumulates postings in memory so they can be written out in bulk
+// as a sorted segment instead of appending to every word's file per page.
+type Builder struct {
+	postings map[termField][]Posting
+	pages    int
+}
+
+func NewBuilder() *Builder {
+	return &Builder{postings: make(map[termField][]Posting)}
+}
+
+// Add records the exact and stemmed word frequencies of a document. Documents
+// must be added in doc ID order. positions holds where each exact word occurs
+// and may be nil when positions aren't being indexed.
+func (b *Builder) Add(docID uint32, wordFreqs, stemmedWordFreqs map[string]int,
+	positions map[string][]uint32) {
+	b.addField(docID, FieldExact, wordFreqs, positions)
+	b.addField(docID, FieldStemmed, stemmedWordFreqs, nil)
+	b.pages++
+}
+
+// maxTermLen is the longest term given a word file, leaving room in a 255
+// byte file name for the extensions. Words are far shorter, but infobox
+// terms are prefixed with their field's name.
+const maxTermLen = 200
+
+func (b *Builder) addField(docID uint32, field Field, freqs map[string]int, positions map[string][]uint32) {
+	for word, freq := range freqs {
+		if len(word) > maxTermLen {
+			continue
+		}
+		key := termField{term: word, field: field}
+		b.postings[key] = append(b.postings[key],
+			Posting{DocID: docID, Freq: uint32(freq), Positions: positions[word]})
+	}
+}
+
+// AddTitle records the exact and stemmed word frequencies of a document's
+// title, right after the document is added.
+func (b *Builder) AddTitle(docID uint32, wordFreqs, stemmedWordFreqs map[string]int) {
+	b.addField(docID, FieldTitle, wordFreqs, nil)
+	b.addField(docID, FieldTitleStemmed, stemmedWordFreqs, nil)
+}
+
+// AddAliases records the words of the redirect titles pointing at a document.
+// Like Add, documents must be added in doc ID order.
+func (b *Builder) AddAliases(docID uint32, wordFreqs map[string]int) {
+	b.addField(docID, FieldAlias, wordFreqs, nil)
+}
+
+// AddInfobox records the InfoboxTerms of a document's infobox, right after
+// the document is added.
+func (b *Builder) AddInfobox(docID uint32, termFreqs map[string]int) {
+	b.addField(docID, FieldInfobox, termFreqs, nil)
+}
+
+// Drop has the word files of the terms in the field rewritten at the next
+// merge even if no doc adds postings to them, which drops the postings of
+// superseded docs from them.
+func (b *Builder) Drop(field Field, terms []string) {
+	for _, term := range terms {
+		if len(term) > maxTermLen {
+			continue
+		}
+		key := termField{term: term, field: field}
+		if _, ok := b.postings[key]; !ok {
+			b.postings[key] = nil
+		}
+	}
+}
+
+// Pages is the number of pages added since the last flush.
+func (b *Builder) Pages() int {
+	return b.pages
+}
+
+// Flush writes the accumulated postings to a new segment in segmentDir and
+// resets the builder. Nothing is written if nothing was added.
+//
+// A segment is a run of records sorted by word then field, each one the
+// uvarint length of the word, the word, and then a posting list encoded the
+// same way as in the word index files.
+func (b *Builder) Flush(segmentDir string) error {
+	if len(b.postings) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(segmentDir, 0755); err != nil {
+		return fmt.Errorf("failed to create segment dir: %w", err)
+	}
+	segments, err := listSegments(segmentDir)
+	if err != nil {
+		return err
+	}
+	segmentPath := filepath.Join(segmentDir, fmt.Sprintf("seg-%06d%s", len(segments)+1, segmentExt))
+	if len(segments) > 0 {
+		var last int
+		if _, err := fmt.Sscanf(filepath.Base(segments[len(segments)-1]), "seg-%06d", &last); err != nil {
+			return fmt.Errorf("failed to parse segment name: %w", err)
+		}
+		segmentPath = filepath.Join(segmentDir, fmt.Sprintf("seg-%06d%s", last+1, segmentExt))
+	}
+
+	keys := make([]termField, 0, len(b.postings))
+	for key := range b.postings {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b termField) int {
+		if c := strings.Compare(a.term, b.term); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.field, b.field)
+	})
+
+	// write to a temp file first so a half written segment is never merged
+	tmpPath := segmentPath + ".tmp"
+	fh, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create segment file: %w", err)
+	}
+	w := bufio.NewWriterSize(fh, 1024*1024)
+	buf := make([]byte, 0, 4096)
+	for _, key := range keys {
+		buf = binary.AppendUvarint(buf[:0], uint64(len(key.term)))
+		buf = append(buf, key.term...)
+		buf, err = appendList(buf, key.field, b.postings[key])
+		if err != nil {
+			_ = fh.Close()
+			return fmt.Errorf("failed to encode %s postings for %s: %w", key.field, key.term, err)
+		}
+		if _, err := w.Write(buf); err != nil {
+			_ = fh.Close()
+			return fmt.Errorf("failed to write segment: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = fh.Close()
+		return fmt.Errorf("failed to flush segment: %w", err)
+	}
+	if err := fh.Sync(); err != nil {
+		_ = fh.Close()
+		return fmt.Errorf("failed to sync segment: %w", err)
+	}
+	if err := fh.Close(); err != nil {
+		return fmt.Errorf("failed to close segment: %w", err)
+	}
+	if err := os.Rename(tmpPath, segmentPath); err != nil {
+		return fmt.Errorf("failed to rename segment: %w", err)
+	}
+
+	b.postings = make(map[termField][]Posting)
+	b.pages = 0
+	return nil
+}
+
+const segmentExt = ".seg"
+
+// listSegments returns the segment files in segmentDir in the order they were
+// flushed.
+func listSegments(segmentDir string) ([]string, error) {
+	entries, err := os.ReadDir(segmentDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read segment dir: %w", err)
+	}
+	segments := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), segmentExt) {
+			segments = append(segments, filepath.Join(segmentDir, e.Name()))
+		}
+	}
+	slices.Sort(segments)
+	return segments, nil
+}
+
+// SegmentCount is the number of segments flushed to segmentDir and not yet
+// merged.
+func SegmentCount(segmentDir string) (int, error) {
+	segments, err := listSegments(segmentDir)
+	return len(segments), err
+}
+
+// RemoveSegmentsAfter removes every segment in segmentDir but the first n
+// flushed, rolling back the flushes made after a checkpoint.
+func RemoveSegmentsAfter(segmentDir string, n int) error {
+	segments, err := listSegments(segmentDir)
+	if err != nil {
+		return err
+	}
+	for _, segmentPath := range segments[min(n, len(segments)):] {
+		if err := os.Remove(segmentPath); err != nil {
+			return fmt.Errorf("failed to remove segment: %w", err)
+		}
+	}
+	return nil
+}
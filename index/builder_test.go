@@ -0,0 +1,157 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBuilderFlush(t *testing.T) {
+	dir := t.TempDir()
+	segmentDir, indexDir := filepath.Join(dir, "segments"), filepath.Join(dir, "index")
+
+	b := NewBuilder()
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(segmentDir); !os.IsNotExist(err) {
+		t.Errorf("flushing nothing created the segment dir: %v", err)
+	}
+
+	b.Add(0, map[string]int{"ferns": 2}, map[string]int{"fern": 2}, nil)
+	b.AddTitle(0, map[string]int{"ferns": 1}, map[string]int{"fern": 1})
+	b.AddInfobox(0, map[string]int{InfoboxTerm("kingdom", "plantae"): 1})
+	b.Add(1, map[string]int{"fern": 1}, map[string]int{"fern": 1}, nil)
+	if b.Pages() != 2 {
+		t.Errorf("Pages() = %d, want 2", b.Pages())
+	}
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	if b.Pages() != 0 {
+		t.Errorf("Pages() = %d after flushing, want 0", b.Pages())
+	}
+	b.Add(2, map[string]int{"moss": 1}, map[string]int{"moss": 1}, nil)
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	// a segment half written when the indexer stopped is never merged
+	if err := os.WriteFile(filepath.Join(segmentDir, "seg-000003"+segmentExt+".tmp"), []byte("torn"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := listSegments(segmentDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(segmentDir, "seg-000001.seg"), filepath.Join(segmentDir, "seg-000002.seg")}
+	if !slices.Equal(segments, want) {
+		t.Fatalf("segments = %v, want %v", segments, want)
+	}
+
+	if err := Merge(segmentDir, indexDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		term  string
+		field Field
+		want  []Posting
+	}{
+		{"ferns", FieldExact, []Posting{{DocID: 0, Freq: 2}}},
+		{"fern", FieldExact, []Posting{{DocID: 1, Freq: 1}}},
+		{"fern", FieldStemmed, []Posting{{DocID: 0, Freq: 2}, {DocID: 1, Freq: 1}}},
+		{"ferns", FieldTitle, []Posting{{DocID: 0, Freq: 1}}},
+		{"fern", FieldTitleStemmed, []Posting{{DocID: 0, Freq: 1}}},
+		{InfoboxTerm("kingdom", "plantae"), FieldInfobox, []Posting{{DocID: 0, Freq: 1}}},
+		{"moss", FieldExact, []Posting{{DocID: 2, Freq: 1}}},
+	} {
+		if got := readTerm(t, indexDir, tt.term, tt.field); !samePostings(got, tt.want) {
+			t.Errorf("%s %s postings = %v, want %v", tt.term, tt.field, got, tt.want)
+		}
+	}
+
+	// new segments are numbered after the last one there
+	if err := os.Remove(filepath.Join(segmentDir, "seg-000003"+segmentExt+".tmp")); err != nil {
+		t.Fatal(err)
+	}
+	b.Add(3, map[string]int{"moss": 1}, nil, nil)
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(segmentDir, "seg-000001.seg"), filepath.Join(segmentDir, "seg-000005.seg")); err != nil {
+		t.Fatal(err)
+	}
+	b.Add(4, map[string]int{"moss": 1}, nil, nil)
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	if segments, err = listSegments(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{filepath.Join(segmentDir, "seg-000005.seg"), filepath.Join(segmentDir, "seg-000006.seg")}
+	if !slices.Equal(segments, want) {
+		t.Errorf("segments = %v, want %v", segments, want)
+	}
+}
+
+func TestBuilderSkipsLongTerms(t *testing.T) {
+	dir := t.TempDir()
+	segmentDir, indexDir := filepath.Join(dir, "segments"), filepath.Join(dir, "index")
+	long := InfoboxTerm(strings.Repeat("field", 40), "gattaca")
+	b := NewBuilder()
+	b.Add(0, map[string]int{"dna": 1}, nil, nil)
+	b.AddInfobox(0, map[string]int{long: 1})
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(segmentDir, indexDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := docIDs(readTerm(t, indexDir, "dna", FieldExact)); !slices.Equal(got, []uint32{0}) {
+		t.Errorf("dna docs = %v, want [0]", got)
+	}
+	path, err := TermPath(indexDir, long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPostingFile(path); err == nil {
+		t.Errorf("a word file was written for a %d byte term", len(long))
+	}
+}
+
+func TestRemoveSegmentsAfter(t *testing.T) {
+	segmentDir := filepath.Join(t.TempDir(), "segments")
+	if n, err := SegmentCount(segmentDir); err != nil || n != 0 {
+		t.Fatalf("SegmentCount() before any flush = %d, %v", n, err)
+	}
+	b := NewBuilder()
+	for docID := range uint32(3) {
+		b.Add(docID, map[string]int{"plant": 1}, nil, nil)
+		if err := b.Flush(segmentDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the last flush came after the checkpoint
+	if err := RemoveSegmentsAfter(segmentDir, 2); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := SegmentCount(segmentDir); err != nil || n != 2 {
+		t.Errorf("SegmentCount() = %d, %v, want 2", n, err)
+	}
+	if err := RemoveSegmentsAfter(segmentDir, 5); err != nil {
+		t.Fatal(err)
+	}
+	// the doc flushed again after resuming gets the next segment
+	b.Add(2, map[string]int{"plant": 1}, nil, nil)
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := listSegments(segmentDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 3 || filepath.Base(segments[2]) != "seg-000003.seg" {
+		t.Errorf("segments = %v", segments)
+	}
+}
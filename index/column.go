@@ -0,0 +1,101 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// uint32Column is an append-only file of little endian uint32s, one per doc,
+// held in memory for lookups that have to be fast for every matching doc.
+type uint32Column struct {
+	fh   *os.File
+	w    *bufio.Writer
+	vals []uint32
+}
+
+// openUint32Column reads the column at path. A value that was only partly
+// written is truncated, unless it's opened read-only and left for the writer.
+func openUint32Column(path string, readOnly bool) (*uint32Column, error) {
+	flag := os.O_RDWR | os.O_CREATE
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+	fh, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open column %s: %w", path, err)
+	}
+	b, err := io.ReadAll(fh)
+	if err != nil {
+		_ = fh.Close()
+		return nil, fmt.Errorf("failed to read column %s: %w", path, err)
+	}
+	c := &uint32Column{fh: fh, vals: make([]uint32, len(b)/4)}
+	for i := range c.vals {
+		c.vals[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	if len(b)%4 != 0 && !readOnly {
+		if err := c.truncate(len(c.vals)); err != nil {
+			_ = fh.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *uint32Column) append(v uint32) error {
+	if c.w == nil {
+		if _, err := c.fh.Seek(int64(len(c.vals))*4, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek column: %w", err)
+		}
+		c.w = bufio.NewWriter(c.fh)
+	}
+	if _, err := c.w.Write(binary.LittleEndian.AppendUint32(nil, v)); err != nil {
+		return fmt.Errorf("failed to write column: %w", err)
+	}
+	c.vals = append(c.vals, v)
+	return nil
+}
+
+func (c *uint32Column) flush() error {
+	if c.w == nil {
+		return nil
+	}
+	if err := c.w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush column: %w", err)
+	}
+	return nil
+}
+
+func (c *uint32Column) sync() error {
+	if err := c.flush(); err != nil {
+		return err
+	}
+	if err := c.fh.Sync(); err != nil {
+		return fmt.Errorf("failed to sync column: %w", err)
+	}
+	return nil
+}
+
+func (c *uint32Column) truncate(n int) error {
+	if err := c.flush(); err != nil {
+		return err
+	}
+	n = min(n, len(c.vals))
+	if err := c.fh.Truncate(int64(n) * 4); err != nil {
+		return fmt.Errorf("failed to truncate column: %w", err)
+	}
+	c.vals = c.vals[:n]
+	c.w = nil
+	return nil
+}
+
+func (c *uint32Column) close() error {
+	err := c.flush()
+	if closeErr := c.fh.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
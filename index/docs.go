@@ -0,0 +1,476 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	docDataFileName   = "docs.jsonl"
+	docOffsetFileName = "docs.off"
+	docTokensFileName = "docs.len"
+	docNSFileName     = "docs.ns"
+	docPageFileName   = "docs.pid"
+)
+
+// Doc is what's known about an indexed page. Its position in the DocTable is
+// its doc ID.
+type Doc struct {
+	RelPath    string    `json:"rel_path"`
+	Title      string    `json:"title"`
+	PageID     int64     `json:"page_id"`
+	RevisionID int64     `json:"revision_id"`
+	SHA1       string    `json:"sha1,omitempty"` // of the revision's wikitext
+	Timestamp  time.Time `json:"timestamp"`
+	ByteLen    int       `json:"byte_len"` // of the wikitext
+	// TokenCount is the number of indexed words in the page, stopwords aren't
+	// counted.
+	TokenCount int `json:"token_count"`
+	// Abstract is the page's abstract, or the start of its text if it has
+	// none.
+	Abstract string `json:"abstract"`
+	// Namespace is the key of the page's namespace, 0 for articles.
+	Namespace int `json:"ns"`
+	// Deleted marks a tombstone, added when a page that was indexed isn't
+	// anymore. It supersedes the page's last doc and is never live itself.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// deletedNamespace is a tombstone's value in the namespace column, which
+// no namespace has.
+const deletedNamespace = math.MaxUint32
+
+// SameRevision reports whether both docs are of the same revision of the
+// same page, so indexing one again would change nothing.
+func (d Doc) SameRevision(other Doc) bool {
+	return d.PageID == other.PageID && d.RevisionID == other.RevisionID &&
+		d.Title == other.Title && d.SHA1 == other.SHA1
+}
+
+// DocTable is an append-only store of Docs addressed by doc ID. Each Doc is a
+// line of JSON in the data file and the offset file holds the little endian
+// uint64 starting offset of each line, so any Doc can be read with one seek.
+// Token counts and namespaces are also kept in columns of their own for
+// ranking and filtering.
+//
+// A page that's indexed again after it changed gets a new doc, the page ID
+// column tells which doc is the page's latest and which it superseded.
+type DocTable struct {
+	mu       sync.Mutex
+	data     *os.File
+	off      *os.File
+	tokens   *uint32Column
+	ns       *uint32Column
+	pages    *uint32Column
+	latest   map[uint32]uint32 // page ID to its latest doc ID
+	dataW    *bufio.Writer
+	offW     *bufio.Writer
+	offsets  []uint64
+	dataSize uint64
+	readOnly bool
+}
+
+// ErrDocTableReadOnly is returned for changes to a doc table opened with
+// OpenDocTableReadOnly.
+var ErrDocTableReadOnly = errors.New("doc table is read-only")
+
+// OpenDocTable opens the doc table in dir for appending, creating it if it
+// doesn't exist and rolling back records torn by a crash.
+func OpenDocTable(dir string) (*DocTable, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create doc table dir: %w", err)
+	}
+	return openDocTable(dir, false)
+}
+
+// OpenDocTableReadOnly opens the doc table in dir for reading while the
+// indexer may be appending to it. Only the docs written to every column are
+// read and nothing is ever truncated.
+func OpenDocTableReadOnly(dir string) (*DocTable, error) {
+	return openDocTable(dir, true)
+}
+
+func openDocTable(dir string, readOnly bool) (*DocTable, error) {
+	if err := checkColumns(dir); err != nil {
+		return nil, err
+	}
+	flag := os.O_RDWR | os.O_CREATE
+	if readOnly {
+		flag = os.O_RDONLY
+	}
+	data, err := os.OpenFile(filepath.Join(dir, docDataFileName), flag, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open doc data: %w", err)
+	}
+	off, err := os.OpenFile(filepath.Join(dir, docOffsetFileName), flag, 0644)
+	if err != nil {
+		_ = data.Close()
+		return nil, fmt.Errorf("failed to open doc offsets: %w", err)
+	}
+	tokens, err := openUint32Column(filepath.Join(dir, docTokensFileName), readOnly)
+	if err != nil {
+		_ = data.Close()
+		_ = off.Close()
+		return nil, err
+	}
+	ns, err := openUint32Column(filepath.Join(dir, docNSFileName), readOnly)
+	if err != nil {
+		_ = data.Close()
+		_ = off.Close()
+		_ = tokens.close()
+		return nil, err
+	}
+	pages, err := openUint32Column(filepath.Join(dir, docPageFileName), readOnly)
+	if err != nil {
+		_ = data.Close()
+		_ = off.Close()
+		_ = tokens.close()
+		_ = ns.close()
+		return nil, err
+	}
+	dt := &DocTable{data: data, off: off, tokens: tokens, ns: ns, pages: pages, readOnly: readOnly}
+	if err := dt.load(); err != nil {
+		_ = dt.Close()
+		return nil, err
+	}
+	return dt, nil
+}
+
+// ErrDocTableFormat is returned for doc tables missing one of the columns,
+// which are from an older index format.
+var ErrDocTableFormat = errors.New("unsupported doc table format")
+
+// checkColumns makes sure a table with docs has every column, one that's
+// missing would otherwise be taken for a crash before any doc was synced and
+// have every doc rolled back.
+func checkColumns(dir string) error {
+	fi, err := os.Stat(filepath.Join(dir, docDataFileName))
+	if errors.Is(err, os.ErrNotExist) || (err == nil && fi.Size() == 0) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat doc data: %w", err)
+	}
+	for _, name := range []string{docTokensFileName, docNSFileName, docPageFileName} {
+		if _, err := os.Stat(filepath.Join(dir, name)); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: no %s column", ErrDocTableFormat, name)
+		}
+	}
+	return nil
+}
+
+func (dt *DocTable) load() error {
+	offBytes, err := io.ReadAll(dt.off)
+	if err != nil {
+		return fmt.Errorf("failed to read doc offsets: %w", err)
+	}
+	dt.offsets = make([]uint64, len(offBytes)/8)
+	for i := range dt.offsets {
+		dt.offsets[i] = binary.LittleEndian.Uint64(offBytes[i*8:])
+	}
+	fi, err := dt.data.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat doc data: %w", err)
+	}
+	dt.dataSize = uint64(fi.Size())
+	// drop the records that were only partly written before a crash
+	n := min(len(dt.offsets), len(dt.tokens.vals), len(dt.ns.vals), len(dt.pages.vals))
+	if n > 0 && dt.offsets[n-1] >= dt.dataSize {
+		n--
+	}
+	if dt.readOnly {
+		return dt.loadWritten(n)
+	}
+	if n != len(dt.offsets) || n != len(dt.tokens.vals) || n != len(dt.ns.vals) ||
+		n != len(dt.pages.vals) || len(offBytes)%8 != 0 {
+		return dt.truncate(n)
+	}
+	dt.loadLatest()
+	return nil
+}
+
+// loadWritten reads the first n docs of a table that may be being appended
+// to, leaving out the last ones until one's record was written in full.
+func (dt *DocTable) loadWritten(n int) error {
+	for ; n > 0; n-- {
+		end := dt.dataSize
+		if n < len(dt.offsets) {
+			end = dt.offsets[n]
+		}
+		if end > dt.dataSize {
+			continue
+		}
+		b := make([]byte, end-dt.offsets[n-1])
+		if _, err := dt.data.ReadAt(b, int64(dt.offsets[n-1])); err != nil {
+			return fmt.Errorf("failed to read doc %d: %w", n-1, err)
+		}
+		if bytes.IndexByte(b, '\n') >= 0 {
+			dt.dataSize = end
+			break
+		}
+	}
+	dt.offsets = dt.offsets[:n]
+	dt.tokens.vals = dt.tokens.vals[:n]
+	dt.ns.vals = dt.ns.vals[:n]
+	dt.pages.vals = dt.pages.vals[:n]
+	if n == 0 {
+		dt.dataSize = 0
+	}
+	dt.loadLatest()
+	return nil
+}
+
+func (dt *DocTable) loadLatest() {
+	dt.latest = make(map[uint32]uint32, len(dt.pages.vals))
+	for docID, pageID := range dt.pages.vals {
+		dt.latest[pageID] = uint32(docID)
+	}
+}
+
+// Len is the number of docs in the table, also the next doc ID.
+func (dt *DocTable) Len() int {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	return len(dt.offsets)
+}
+
+// Append adds doc to the table and returns its doc ID. Appends are buffered
+// until Sync.
+func (dt *DocTable) Append(doc Doc) (uint32, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal doc: %w", err)
+	}
+	b = append(b, '\n')
+
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if dt.readOnly {
+		return 0, ErrDocTableReadOnly
+	}
+	if dt.dataW == nil {
+		if _, err := dt.data.Seek(0, io.SeekEnd); err != nil {
+			return 0, fmt.Errorf("failed to seek doc data: %w", err)
+		}
+		if _, err := dt.off.Seek(0, io.SeekEnd); err != nil {
+			return 0, fmt.Errorf("failed to seek doc offsets: %w", err)
+		}
+		dt.dataW = bufio.NewWriterSize(dt.data, 1024*1024)
+		dt.offW = bufio.NewWriter(dt.off)
+	}
+	id := uint32(len(dt.offsets))
+	if _, err := dt.dataW.Write(b); err != nil {
+		return 0, fmt.Errorf("failed to write doc: %w", err)
+	}
+	if _, err := dt.offW.Write(binary.LittleEndian.AppendUint64(nil, dt.dataSize)); err != nil {
+		return 0, fmt.Errorf("failed to write doc offset: %w", err)
+	}
+	if err := dt.tokens.append(uint32(doc.TokenCount)); err != nil {
+		return 0, err
+	}
+	ns := uint32(doc.Namespace)
+	if doc.Deleted {
+		ns = deletedNamespace
+	}
+	if err := dt.ns.append(ns); err != nil {
+		return 0, err
+	}
+	if err := dt.pages.append(uint32(doc.PageID)); err != nil {
+		return 0, err
+	}
+	dt.latest[uint32(doc.PageID)] = id
+	dt.offsets = append(dt.offsets, dt.dataSize)
+	dt.dataSize += uint64(len(b))
+	return id, nil
+}
+
+// TokenCounts returns every doc's token count indexed by doc ID. The slice is
+// shared with the table and must not be modified.
+func (dt *DocTable) TokenCounts() []uint32 {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	return dt.tokens.vals
+}
+
+// Namespaces returns every doc's namespace key indexed by doc ID. Like
+// TokenCounts the slice is shared with the table.
+func (dt *DocTable) Namespaces() []uint32 {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	return dt.ns.vals
+}
+
+// Lookup returns the ID of the page's latest doc.
+func (dt *DocTable) Lookup(pageID int64) (uint32, bool) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	docID, ok := dt.latest[uint32(pageID)]
+	return docID, ok
+}
+
+// Superseded reports whether the doc's page was indexed again or removed
+// since, so the doc and its postings are stale. Tombstones are always
+// superseded.
+func (dt *DocTable) Superseded(docID uint32) bool {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if int(docID) >= len(dt.pages.vals) {
+		return false
+	}
+	if dt.ns.vals[docID] == deletedNamespace {
+		return true
+	}
+	return dt.latest[dt.pages.vals[docID]] != docID
+}
+
+// Get reads the doc with the given ID.
+func (dt *DocTable) Get(id uint32) (Doc, error) {
+	dt.mu.Lock()
+	if int(id) >= len(dt.offsets) {
+		dt.mu.Unlock()
+		return Doc{}, fmt.Errorf("doc id %d out of range", id)
+	}
+	if err := dt.flush(); err != nil {
+		dt.mu.Unlock()
+		return Doc{}, err
+	}
+	start, end := dt.offsets[id], dt.dataSize
+	if int(id)+1 < len(dt.offsets) {
+		end = dt.offsets[id+1]
+	}
+	dt.mu.Unlock()
+
+	b := make([]byte, end-start)
+	if _, err := dt.data.ReadAt(b, int64(start)); err != nil {
+		return Doc{}, fmt.Errorf("failed to read doc %d: %w", id, err)
+	}
+	// the last record can be followed by a torn write, it ends at its newline
+	b, _, _ = bytes.Cut(b, []byte("\n"))
+	var doc Doc
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return Doc{}, fmt.Errorf("failed to unmarshal doc %d: %w", id, err)
+	}
+	return doc, nil
+}
+
+func (dt *DocTable) flush() error {
+	if err := dt.tokens.flush(); err != nil {
+		return err
+	}
+	if err := dt.ns.flush(); err != nil {
+		return err
+	}
+	if err := dt.pages.flush(); err != nil {
+		return err
+	}
+	if dt.dataW == nil {
+		return nil
+	}
+	if err := dt.dataW.Flush(); err != nil {
+		return fmt.Errorf("failed to flush doc data: %w", err)
+	}
+	if err := dt.offW.Flush(); err != nil {
+		return fmt.Errorf("failed to flush doc offsets: %w", err)
+	}
+	return nil
+}
+
+// Sync makes every appended doc durable.
+func (dt *DocTable) Sync() error {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if err := dt.flush(); err != nil {
+		return err
+	}
+	// data first, so a synced offset never points past the synced data
+	if err := dt.data.Sync(); err != nil {
+		return fmt.Errorf("failed to sync doc data: %w", err)
+	}
+	if err := dt.off.Sync(); err != nil {
+		return fmt.Errorf("failed to sync doc offsets: %w", err)
+	}
+	if err := dt.tokens.sync(); err != nil {
+		return err
+	}
+	if err := dt.ns.sync(); err != nil {
+		return err
+	}
+	return dt.pages.sync()
+}
+
+// Truncate drops every doc with an ID of n or more, used to roll back to a
+// checkpoint.
+func (dt *DocTable) Truncate(n int) error {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if dt.readOnly {
+		return ErrDocTableReadOnly
+	}
+	if err := dt.flush(); err != nil {
+		return err
+	}
+	return dt.truncate(n)
+}
+
+func (dt *DocTable) truncate(n int) error {
+	if n > len(dt.offsets) {
+		return fmt.Errorf("can't truncate %d docs to %d", len(dt.offsets), n)
+	}
+	if err := dt.tokens.truncate(n); err != nil {
+		return err
+	}
+	if err := dt.ns.truncate(n); err != nil {
+		return err
+	}
+	if err := dt.pages.truncate(n); err != nil {
+		return err
+	}
+	dataSize := dt.dataSize
+	if n < len(dt.offsets) {
+		dataSize = dt.offsets[n]
+	}
+	if err := dt.data.Truncate(int64(dataSize)); err != nil {
+		return fmt.Errorf("failed to truncate doc data: %w", err)
+	}
+	if err := dt.off.Truncate(int64(n) * 8); err != nil {
+		return fmt.Errorf("failed to truncate doc offsets: %w", err)
+	}
+	dt.offsets = dt.offsets[:n]
+	dt.dataSize = dataSize
+	dt.loadLatest()
+	// the writers have to seek to the new ends before appending again
+	dt.dataW, dt.offW = nil, nil
+	return nil
+}
+
+func (dt *DocTable) Close() error {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	err := dt.flush()
+	if closeErr := dt.data.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dt.off.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dt.tokens.close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dt.ns.close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dt.pages.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
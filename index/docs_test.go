@@ -0,0 +1,320 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func openTestDocTable(t *testing.T, dir string) *DocTable {
+	t.Helper()
+	dt, err := OpenDocTable(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = dt.Close() })
+	return dt
+}
+
+func appendDocs(t *testing.T, dt *DocTable, docs ...Doc) {
+	t.Helper()
+	for _, doc := range docs {
+		if _, err := dt.Append(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dt.Sync(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDocTableNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	dt := openTestDocTable(t, dir)
+	appendDocs(t, dt,
+		Doc{Title: "Plant", PageID: 2, TokenCount: 10},
+		Doc{Title: "Category:Plants", PageID: 6, TokenCount: 3, Namespace: 14},
+	)
+	if got := dt.Namespaces(); !slices.Equal(got, []uint32{0, 14}) {
+		t.Errorf("Namespaces() = %v, want [0 14]", got)
+	}
+	if err := dt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dt = openTestDocTable(t, dir)
+	if got := dt.Namespaces(); !slices.Equal(got, []uint32{0, 14}) {
+		t.Errorf("reopened Namespaces() = %v, want [0 14]", got)
+	}
+	doc, err := dt.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Title != "Category:Plants" || doc.Namespace != 14 {
+		t.Errorf("Get(1) = %+v", doc)
+	}
+}
+
+func TestDocTableMissingColumn(t *testing.T) {
+	dir := t.TempDir()
+	dt := openTestDocTable(t, dir)
+	appendDocs(t, dt, Doc{Title: "Plant", PageID: 2})
+	if err := dt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, docNSFileName)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenDocTable(dir); !errors.Is(err, ErrDocTableFormat) {
+		t.Errorf("OpenDocTable() = %v, want ErrDocTableFormat", err)
+	}
+}
+
+func TestDocTableSupersedes(t *testing.T) {
+	dir := t.TempDir()
+	dt := openTestDocTable(t, dir)
+	appendDocs(t, dt,
+		Doc{Title: "Plant", PageID: 2, RevisionID: 200},
+		Doc{Title: "Chloroplast", PageID: 7, RevisionID: 700},
+		Doc{Title: "Plant", PageID: 2, RevisionID: 202},     // a new revision
+		Doc{Title: "Chloroplast", PageID: 7, Deleted: true}, // now a redirect
+	)
+	check := func(dt *DocTable) {
+		t.Helper()
+		for docID, want := range []bool{true, true, false, true} {
+			if got := dt.Superseded(uint32(docID)); got != want {
+				t.Errorf("Superseded(%d) = %t, want %t", docID, got, want)
+			}
+		}
+		if docID, ok := dt.Lookup(2); !ok || docID != 2 {
+			t.Errorf("Lookup(2) = %d, %t, want 2, true", docID, ok)
+		}
+		if docID, ok := dt.Lookup(7); !ok || docID != 3 {
+			t.Errorf("Lookup(7) = %d, %t, want the tombstone 3, true", docID, ok)
+		}
+		if _, ok := dt.Lookup(11); ok {
+			t.Error("Lookup(11) found a page that was never indexed")
+		}
+	}
+	check(dt)
+	if err := dt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dt = openTestDocTable(t, dir)
+	check(dt)
+
+	// rolling back to a checkpoint brings the page's earlier doc back
+	if err := dt.Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+	if dt.Superseded(0) || dt.Superseded(1) {
+		t.Error("docs are still superseded by docs rolled back")
+	}
+}
+
+func TestDocSameRevision(t *testing.T) {
+	doc := Doc{Title: "Plant", PageID: 2, RevisionID: 200, SHA1: "abc"}
+	tests := []struct {
+		name  string
+		other Doc
+		want  bool
+	}{
+		{"same", doc, true},
+		{"new revision", Doc{Title: "Plant", PageID: 2, RevisionID: 201, SHA1: "abd"}, false},
+		{"other text", Doc{Title: "Plant", PageID: 2, RevisionID: 200, SHA1: "abd"}, false},
+		{"renamed", Doc{Title: "Plants", PageID: 2, RevisionID: 200, SHA1: "abc"}, false},
+		{"other page", Doc{Title: "Plant", PageID: 3, RevisionID: 200, SHA1: "abc"}, false},
+	}
+	for _, tt := range tests {
+		if got := doc.SameRevision(tt.other); got != tt.want {
+			t.Errorf("%s: SameRevision() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDocTableRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	dt := openTestDocTable(t, dir)
+	want := []Doc{
+		{
+			RelPath: "p/l/a/plant.xml", Title: "Plant", PageID: 2, RevisionID: 200, SHA1: "abc",
+			Timestamp: time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC), ByteLen: 5000, TokenCount: 700,
+			Abstract: "Plants are \"green\"\nand alive — mostly.",
+		},
+		{Title: "Fern", PageID: 3, RevisionID: 300, TokenCount: 40},
+	}
+	for i, doc := range want {
+		docID, err := dt.Append(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if docID != uint32(i) {
+			t.Errorf("Append() = %d, want %d", docID, i)
+		}
+	}
+	check := func(dt *DocTable) {
+		t.Helper()
+		if dt.Len() != 2 || !slices.Equal(dt.TokenCounts(), []uint32{700, 40}) {
+			t.Errorf("Len() = %d, TokenCounts() = %v", dt.Len(), dt.TokenCounts())
+		}
+		for i, w := range want {
+			if got, err := dt.Get(uint32(i)); err != nil || got != w {
+				t.Errorf("Get(%d) = %+v, %v, want %+v", i, got, err, w)
+			}
+		}
+		if _, err := dt.Get(2); err == nil {
+			t.Error("Get(2) of a table of 2 docs succeeded")
+		}
+	}
+	// docs can be read before they're synced
+	check(dt)
+	if err := dt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	check(openTestDocTable(t, dir))
+}
+
+func TestDocTableTruncate(t *testing.T) {
+	dir := t.TempDir()
+	dt := openTestDocTable(t, dir)
+	appendDocs(t, dt,
+		Doc{Title: "Plant", PageID: 2, TokenCount: 10},
+		Doc{Title: "Fern", PageID: 3, TokenCount: 20},
+		Doc{Title: "Moss", PageID: 4, TokenCount: 30},
+	)
+	if err := dt.Truncate(4); err == nil {
+		t.Error("truncated 3 docs to 4")
+	}
+	if err := dt.Truncate(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dt.Lookup(3); ok {
+		t.Error("Lookup(3) found a doc rolled back")
+	}
+	// doc IDs are given out again from where the table was cut
+	appendDocs(t, dt, Doc{Title: "Tree", PageID: 5, TokenCount: 40})
+	if err := dt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dt = openTestDocTable(t, dir)
+	if dt.Len() != 2 || !slices.Equal(dt.TokenCounts(), []uint32{10, 40}) {
+		t.Fatalf("Len() = %d, TokenCounts() = %v after truncating", dt.Len(), dt.TokenCounts())
+	}
+	if doc, err := dt.Get(1); err != nil || doc.Title != "Tree" {
+		t.Errorf("Get(1) = %+v, %v, want Tree", doc, err)
+	}
+}
+
+func TestDocTableTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	dt := openTestDocTable(t, dir)
+	appendDocs(t, dt, Doc{Title: "Plant", PageID: 2, TokenCount: 10})
+	if err := dt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash part way through the next doc: its token count and offset were
+	// written but only some of its data
+	appendFile := func(name string, b []byte) {
+		t.Helper()
+		fh, err := os.OpenFile(filepath.Join(dir, name), os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fh.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		if err := fh.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fi, err := os.Stat(filepath.Join(dir, docDataFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendFile(docTokensFileName, binary.LittleEndian.AppendUint32(nil, 20))
+	appendFile(docOffsetFileName, binary.LittleEndian.AppendUint64(nil, uint64(fi.Size())))
+	appendFile(docDataFileName, []byte(`{"title":"Fe`))
+
+	dt = openTestDocTable(t, dir)
+	if dt.Len() != 1 || !slices.Equal(dt.TokenCounts(), []uint32{10}) {
+		t.Fatalf("Len() = %d, TokenCounts() = %v, want only the synced doc", dt.Len(), dt.TokenCounts())
+	}
+	appendDocs(t, dt, Doc{Title: "Fern", PageID: 3, TokenCount: 20})
+	if doc, err := dt.Get(1); err != nil || doc.Title != "Fern" {
+		t.Errorf("Get(1) = %+v, %v, want Fern", doc, err)
+	}
+}
+
+func TestDocTableReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	dt := openTestDocTable(t, dir)
+	appendDocs(t, dt, Doc{Title: "Plant", PageID: 2, TokenCount: 10}, Doc{Title: "Moss", PageID: 3, TokenCount: 5})
+	if err := dt.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the indexer is part way through the next doc: every column but the
+	// data has it
+	fi, err := os.Stat(filepath.Join(dir, docDataFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial := map[string][]byte{
+		docTokensFileName: binary.LittleEndian.AppendUint32(nil, 20),
+		docNSFileName:     binary.LittleEndian.AppendUint32(nil, 0),
+		docPageFileName:   binary.LittleEndian.AppendUint32(nil, 4),
+		docOffsetFileName: binary.LittleEndian.AppendUint64(nil, uint64(fi.Size())),
+		docDataFileName:   []byte(`{"title":"Fe`),
+	}
+	for name, b := range partial {
+		fh, err := os.OpenFile(filepath.Join(dir, name), os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fh.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		if err := fh.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ro, err := OpenDocTableReadOnly(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ro.Len() != 2 || !slices.Equal(ro.TokenCounts(), []uint32{10, 5}) {
+		t.Errorf("Len() = %d, TokenCounts() = %v, want the 2 written docs", ro.Len(), ro.TokenCounts())
+	}
+	if doc, err := ro.Get(1); err != nil || doc.Title != "Moss" {
+		t.Errorf("Get(1) = %+v, %v, want Moss", doc, err)
+	}
+	if _, ok := ro.Lookup(4); ok {
+		t.Error("Lookup found the doc being written")
+	}
+	if _, err := ro.Append(Doc{Title: "Tree", PageID: 5}); !errors.Is(err, ErrDocTableReadOnly) {
+		t.Errorf("Append() = %v, want ErrDocTableReadOnly", err)
+	}
+
+	if err := ro.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the doc being written is left for the indexer to finish
+	for name, b := range partial {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasSuffix(got, b) {
+			t.Errorf("%s was truncated", name)
+		}
+	}
+}
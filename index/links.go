@@ -0,0 +1,28 @@
+package index
+
+import (
+	"path/filepath"
+)
+
+const linkFileName = "links.jsonl"
+
+// PageLinks is the outbound links of a doc, the titles of the pages it links
+// to and the names of the categories it's in, in the order they first appear.
+type PageLinks struct {
+	DocID      uint32   `json:"doc"`
+	To         []string `json:"to"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+// LinkTable is an append-only file of PageLinks, a line of JSON each.
+type LinkTable = appendLog[PageLinks]
+
+func OpenLinkTable(dir string) (*LinkTable, error) {
+	return openAppendLog[PageLinks](dir, linkFileName, "link table")
+}
+
+// ReadLinks calls fn with the links of every doc in the link table in dir. A
+// missing table has no links.
+func ReadLinks(dir string, fn func(PageLinks) error) error {
+	return readAppendLog(filepath.Join(dir, linkFileName), "link table", fn)
+}
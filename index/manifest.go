@@ -0,0 +1,157 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/samiam2013/wiki4dummies/normalize"
+	"github.com/samiam2013/wiki4dummies/wiki"
+)
+
+const manifestFileName = "manifest.json"
+
+// FormatVersion is the layout of the files in save_path, bumped whenever a
+// change leaves older indexes unreadable.
+const FormatVersion = 2
+
+var ErrIncompatibleIndex = errors.New("index was built incompatibly")
+
+// Manifest describes the wiki an index was built from, taken from the
+// siteinfo of the first dump ingested into it, and how it was built.
+type Manifest struct {
+	Build      Build       `json:"build"`
+	DBName     string      `json:"dbname"` // like enwiki
+	Sitename   string      `json:"sitename"`
+	Base       string      `json:"base"` // the URL of the wiki's main page
+	Generator  string      `json:"generator"`
+	Case       string      `json:"case"` // how titles are capitalized
+	Namespaces []Namespace `json:"namespaces"`
+	// LastDumpDate is the date of the last dump ingested to the end, full or
+	// incremental, like 20241001.
+	LastDumpDate string `json:"last_dump_date,omitempty"`
+}
+
+// Build is how an index was built, everything that has to stay the same for
+// queries to be split into the words pages were indexed under and for page
+// and word files to be found. Indexes from before it was recorded have none.
+type Build struct {
+	Format    int    `json:"format"`
+	Postings  int    `json:"postings"` // the posting file version written
+	Tokenizer int    `json:"tokenizer"`
+	Stemmer   string `json:"stemmer"`
+	Stopwords string `json:"stopwords"` // hash of the frequent words left out
+	Slugs     int    `json:"slugs"`
+	TrieDepth int    `json:"trie_depth"`
+	// Positions is whether word positions were recorded, which every page
+	// of an index has or none do. It's up to the indexer, so it isn't
+	// compared by Compatible.
+	Positions bool `json:"positions"`
+}
+
+// CurrentBuild is how this binary builds indexes.
+func CurrentBuild() Build {
+	return Build{
+		Format:    FormatVersion,
+		Postings:  PostingVersion,
+		Tokenizer: normalize.TokenizerVersion,
+		Stemmer:   normalize.Stemmer(),
+		Stopwords: wiki.StopwordsHash(),
+		Slugs:     normalize.SlugVersion,
+		TrieDepth: normalize.TrieDepth,
+	}
+}
+
+// Compatible checks that an index built as b can be searched by a binary
+// building indexes as current, naming every difference if not. Indexes from
+// before builds were recorded never are.
+func (b Build) Compatible(current Build) error {
+	if b.Format == 0 {
+		return fmt.Errorf("%w: no build recorded", ErrIncompatibleIndex)
+	}
+	var diffs []string
+	if b.Format != current.Format {
+		diffs = append(diffs, fmt.Sprintf("format %d, not %d", b.Format, current.Format))
+	}
+	if b.Postings != current.Postings {
+		diffs = append(diffs, fmt.Sprintf("posting version %d, not %d", b.Postings, current.Postings))
+	}
+	if b.Tokenizer != current.Tokenizer {
+		diffs = append(diffs, fmt.Sprintf("tokenizer %d, not %d", b.Tokenizer, current.Tokenizer))
+	}
+	if !sameStemmer(b.Stemmer, current.Stemmer) {
+		diffs = append(diffs, fmt.Sprintf("stemmer %s, not %s", b.Stemmer, current.Stemmer))
+	}
+	if b.Stopwords != current.Stopwords {
+		diffs = append(diffs, fmt.Sprintf("stopwords %s, not %s", b.Stopwords, current.Stopwords))
+	}
+	if b.Slugs != current.Slugs {
+		diffs = append(diffs, fmt.Sprintf("slugs %d, not %d", b.Slugs, current.Slugs))
+	}
+	if b.TrieDepth != current.TrieDepth {
+		diffs = append(diffs, fmt.Sprintf("trie depth %d, not %d", b.TrieDepth, current.TrieDepth))
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%w: %s", ErrIncompatibleIndex, strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+// sameStemmer compares stemmer modules, and their versions when both binaries
+// knew them.
+func sameStemmer(a, b string) bool {
+	pathA, versionA, okA := strings.Cut(a, "@")
+	pathB, versionB, okB := strings.Cut(b, "@")
+	return pathA == pathB && (!okA || !okB || versionA == versionB)
+}
+
+// Namespace is one of the wiki's namespaces. The main namespace, the
+// articles, has no name.
+type Namespace struct {
+	Key  int    `json:"key"`
+	Name string `json:"name"`
+	Case string `json:"case"`
+}
+
+// Namespace looks up the namespace with the key as written in a page's <ns>.
+func (m Manifest) Namespace(key string) (Namespace, bool) {
+	k, err := strconv.Atoi(key)
+	if err != nil {
+		return Namespace{}, false
+	}
+	for _, ns := range m.Namespaces {
+		if ns.Key == k {
+			return ns, true
+		}
+	}
+	return Namespace{}, false
+}
+
+// ReadManifest reads the manifest in savePath.
+func ReadManifest(savePath string) (Manifest, error) {
+	b, err := os.ReadFile(filepath.Join(savePath, manifestFileName))
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return Manifest{}, fmt.Errorf("failed to unmarshal manifest: %w", err)
+	}
+	return m, nil
+}
+
+// WriteManifest replaces the manifest in savePath.
+func WriteManifest(savePath string, m Manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := os.MkdirAll(savePath, 0755); err != nil {
+		return fmt.Errorf("failed to create save path: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(savePath, manifestFileName), b)
+}
@@ -0,0 +1,88 @@
+package index
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBuildCompatible(t *testing.T) {
+	current := CurrentBuild()
+	tests := []struct {
+		name   string
+		change func(b *Build)
+		ok     bool
+	}{
+		{"same", func(b *Build) {}, true},
+		{"not recorded", func(b *Build) { *b = Build{} }, false},
+		{"other format", func(b *Build) { b.Format++ }, false},
+		{"newer postings", func(b *Build) { b.Postings++ }, false},
+		{"older postings", func(b *Build) { b.Postings-- }, false},
+		{"other tokenizer", func(b *Build) { b.Tokenizer++ }, false},
+		{"other stopwords", func(b *Build) { b.Stopwords = "0000000000000000" }, false},
+		{"other slugs", func(b *Build) { b.Slugs++ }, false},
+		{"other trie depth", func(b *Build) { b.TrieDepth++ }, false},
+		{"other stemmer", func(b *Build) { b.Stemmer = "example.com/stemmer@v1.0.0" }, false},
+		{"other stemmer version", func(b *Build) { b.Stemmer = stemmerPath(current) + "@v9.9.9" }, false},
+		{"stemmer version unknown", func(b *Build) { b.Stemmer = stemmerPath(current) }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := current
+			tt.change(&b)
+			err := b.Compatible(current)
+			if tt.ok && err != nil {
+				t.Errorf("Compatible() = %v, want nil", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrIncompatibleIndex) {
+				t.Errorf("Compatible() = %v, want ErrIncompatibleIndex", err)
+			}
+		})
+	}
+}
+
+func stemmerPath(b Build) string {
+	path, _, _ := strings.Cut(b.Stemmer, "@")
+	return path
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	m := Manifest{
+		Build:        CurrentBuild(),
+		DBName:       "enwiki",
+		Namespaces:   []Namespace{{Key: 0}, {Key: 14, Name: "Category"}},
+		LastDumpDate: "20241001",
+	}
+	if err := WriteManifest(dir, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Build != m.Build || got.DBName != m.DBName || got.LastDumpDate != m.LastDumpDate {
+		t.Errorf("ReadManifest() = %+v, want %+v", got, m)
+	}
+	if ns, ok := got.Namespace("14"); !ok || ns.Name != "Category" {
+		t.Errorf("Namespace(14) = %+v, %t", ns, ok)
+	}
+	if _, ok := got.Namespace("1"); ok {
+		t.Error("Namespace(1) found a namespace the wiki doesn't have")
+	}
+}
+
+func TestManifestNamespace(t *testing.T) {
+	m := Manifest{Namespaces: []Namespace{{Key: 0}, {Key: 14, Name: "Category"}}}
+	if ns, ok := m.Namespace("14"); !ok || ns.Name != "Category" {
+		t.Errorf("Namespace(14) = %+v, %t", ns, ok)
+	}
+	if ns, ok := m.Namespace("0"); !ok || ns.Name != "" {
+		t.Errorf("Namespace(0) = %+v, %t", ns, ok)
+	}
+	for _, key := range []string{"1", "Category", ""} {
+		if _, ok := m.Namespace(key); ok {
+			t.Errorf("Namespace(%q) found a namespace", key)
+		}
+	}
+}
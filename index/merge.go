@@ -0,0 +1,237 @@
+package index
+
+import (
+	"bufio"
+	"cmp"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/samiam2013/wiki4dummies/normalize"
+)
+
+// TermPath is where a word's index file lives under indexDir.
+func TermPath(indexDir, term string) (string, error) {
+	triePath, err := normalize.TrieMake(indexDir, term)
+	if err != nil {
+		return "", fmt.Errorf("failed to make trie path: %w", err)
+	}
+	return filepath.Join(triePath, term+".idx"), nil
+}
+
+// Merge combines every segment in segmentDir into the word index files under
+// indexDir and removes the segments. A doc's postings replace the ones it
+// already has in an index file, or in an earlier segment, and the postings of
+// superseded docs are dropped from every index file rewritten. A word whose
+// file can't be merged is logged and skipped.
+func Merge(segmentDir, indexDir string, superseded func(docID uint32) bool) error {
+	segments, err := listSegments(segmentDir)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return nil
+	}
+
+	readers := make([]*segmentReader, 0, len(segments))
+	defer func() {
+		for _, r := range readers {
+			_ = r.fh.Close()
+		}
+	}()
+	h := &segmentHeap{}
+	for i, segmentPath := range segments {
+		r, err := openSegment(segmentPath, i)
+		if err != nil {
+			return err
+		}
+		readers = append(readers, r)
+		if r.next() {
+			heap.Push(h, r)
+		}
+		if r.err != nil {
+			return r.err
+		}
+	}
+
+	// pop every reader positioned on the smallest word, the heap breaks ties
+	// by segment order so postings stay in flush order
+	for h.Len() > 0 {
+		term := (*h)[0].term
+		lists := map[Field][]Posting{}
+		for h.Len() > 0 && (*h)[0].term == term {
+			r := (*h)[0]
+			for r.term == term {
+				it := r.list.iterator()
+				lists[r.list.field] = it.appendAll(lists[r.list.field])
+				if err := it.Err(); err != nil {
+					return fmt.Errorf("failed decoding segment %s: %w", r.fh.Name(), err)
+				}
+				if !r.next() {
+					break
+				}
+			}
+			if r.err != nil {
+				return r.err
+			}
+			if r.done {
+				heap.Pop(h)
+				continue
+			}
+			heap.Fix(h, 0)
+		}
+		// one bad word file shouldn't cost every other word its postings
+		if err := mergeTerm(indexDir, term, lists, superseded); err != nil {
+			slog.Error("Failed to merge term, skipping it", "term", term, "error", err)
+		}
+	}
+
+	for _, segmentPath := range segments {
+		if err := os.Remove(segmentPath); err != nil {
+			return fmt.Errorf("failed to remove merged segment: %w", err)
+		}
+	}
+	return nil
+}
+
+// mergeTerm rewrites a word's index file with the new postings merged into
+// the ones it already has.
+func mergeTerm(indexDir, term string, lists map[Field][]Posting, superseded func(docID uint32) bool) error {
+	idxPath, err := TermPath(indexDir, term)
+	if err != nil {
+		return err
+	}
+	existing, err := ReadPostingFile(idxPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read index file for %s: %w", term, err)
+	}
+	if existing != nil {
+		for _, l := range existing.lists {
+			ps, err := existing.Postings(l.field)
+			if err != nil {
+				return fmt.Errorf("failed to decode index file for %s: %w", term, err)
+			}
+			lists[l.field] = append(ps, lists[l.field]...)
+		}
+	}
+	for field, ps := range lists {
+		lists[field] = latestPostings(ps, superseded)
+	}
+	b, err := EncodePostingFile(lists)
+	if err != nil {
+		return fmt.Errorf("failed to merge postings for %s: %w", term, err)
+	}
+	return writeFileAtomic(idxPath, b)
+}
+
+// latestPostings orders ps by doc ID, keeping only the last of a doc's
+// postings and dropping superseded docs. Postings of a doc indexed again,
+// like its aliases on a second run, come after the ones they replace.
+func latestPostings(ps []Posting, superseded func(docID uint32) bool) []Posting {
+	slices.SortStableFunc(ps, func(a, b Posting) int { return cmp.Compare(a.DocID, b.DocID) })
+	kept := ps[:0]
+	for i, p := range ps {
+		if i+1 < len(ps) && ps[i+1].DocID == p.DocID {
+			continue
+		}
+		if superseded != nil && superseded(p.DocID) {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, b, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", tmpPath, err)
+	}
+	return nil
+}
+
+type segmentReader struct {
+	fh    *os.File
+	r     *bufio.Reader
+	order int
+	term  string
+	list  listHeader
+	done  bool
+	err   error
+}
+
+func openSegment(segmentPath string, order int) (*segmentReader, error) {
+	fh, err := os.Open(segmentPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment: %w", err)
+	}
+	return &segmentReader{fh: fh, r: bufio.NewReaderSize(fh, 1024*1024), order: order}, nil
+}
+
+// next advances to the following posting list, returning false at the end of
+// the segment or on error.
+func (r *segmentReader) next() bool {
+	termLen, err := binary.ReadUvarint(r.r)
+	if errors.Is(err, io.EOF) {
+		r.done = true
+		return false
+	}
+	if err == nil {
+		termBytes := make([]byte, termLen)
+		_, err = io.ReadFull(r.r, termBytes)
+		r.term = string(termBytes)
+	}
+	var field byte
+	if err == nil {
+		field, err = r.r.ReadByte()
+		r.list.field = Field(field)
+	}
+	if err == nil {
+		r.list.flags, err = r.r.ReadByte()
+	}
+	var count, size uint64
+	if err == nil {
+		count, err = binary.ReadUvarint(r.r)
+		r.list.count = int(count)
+	}
+	if err == nil {
+		size, err = binary.ReadUvarint(r.r)
+	}
+	if err == nil {
+		r.list.data = make([]byte, size)
+		_, err = io.ReadFull(r.r, r.list.data)
+	}
+	if err != nil {
+		r.err = fmt.Errorf("failed reading segment %s: %w", r.fh.Name(), err)
+		r.done = true
+		return false
+	}
+	return true
+}
+
+type segmentHeap []*segmentReader
+
+func (h segmentHeap) Len() int { return len(h) }
+func (h segmentHeap) Less(i, j int) bool {
+	if h[i].term == h[j].term {
+		return h[i].order < h[j].order
+	}
+	return h[i].term < h[j].term
+}
+func (h segmentHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *segmentHeap) Push(x any)   { *h = append(*h, x.(*segmentReader)) }
+func (h *segmentHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
@@ -0,0 +1,200 @@
+package index
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// readTerm decodes a field of a term's word file under indexDir.
+func readTerm(t *testing.T, indexDir, term string, field Field) []Posting {
+	t.Helper()
+	path, err := TermPath(indexDir, term)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pf, err := ReadPostingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps, err := pf.Postings(field)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ps
+}
+
+func docIDs(ps []Posting) []uint32 {
+	ids := make([]uint32, 0, len(ps))
+	for _, p := range ps {
+		ids = append(ids, p.DocID)
+	}
+	return ids
+}
+
+func TestMergeDropsSupersededDocs(t *testing.T) {
+	dir := t.TempDir()
+	segmentDir, indexDir := filepath.Join(dir, "segments"), filepath.Join(dir, "index")
+
+	b := NewBuilder()
+	b.Add(0, map[string]int{"plant": 1, "soil": 1}, nil, nil)
+	b.Add(1, map[string]int{"plant": 2}, nil, nil)
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(segmentDir, indexDir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// doc 2 is a new revision of doc 0's page, without soil
+	b.Add(2, map[string]int{"plant": 3}, nil, nil)
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	superseded := func(docID uint32) bool { return docID == 0 }
+	if err := Merge(segmentDir, indexDir, superseded); err != nil {
+		t.Fatal(err)
+	}
+	if got := docIDs(readTerm(t, indexDir, "plant", FieldExact)); !slices.Equal(got, []uint32{1, 2}) {
+		t.Errorf("plant docs = %v, want [1 2]", got)
+	}
+	// soil's word file wasn't rewritten, so the server filters doc 0 out
+	if got := docIDs(readTerm(t, indexDir, "soil", FieldExact)); !slices.Equal(got, []uint32{0}) {
+		t.Errorf("soil docs = %v, want [0]", got)
+	}
+}
+
+func TestMergeDropsStaleTerms(t *testing.T) {
+	dir := t.TempDir()
+	segmentDir, indexDir := filepath.Join(dir, "segments"), filepath.Join(dir, "index")
+
+	b := NewBuilder()
+	b.Add(0, map[string]int{"plant": 1, "soil": 1}, nil, nil)
+	b.Add(1, map[string]int{"soil": 2}, nil, nil)
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(segmentDir, indexDir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// doc 2 replaces doc 0 without soil, so soil is dropped to rewrite it
+	b.Add(2, map[string]int{"plant": 3}, nil, nil)
+	b.Drop(FieldExact, []string{"plant", "soil"})
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	superseded := func(docID uint32) bool { return docID == 0 }
+	if err := Merge(segmentDir, indexDir, superseded); err != nil {
+		t.Fatal(err)
+	}
+	if got := docIDs(readTerm(t, indexDir, "plant", FieldExact)); !slices.Equal(got, []uint32{2}) {
+		t.Errorf("plant docs = %v, want [2]", got)
+	}
+	if got := docIDs(readTerm(t, indexDir, "soil", FieldExact)); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("soil docs = %v, want [1]", got)
+	}
+}
+
+func TestMergeReplacesADocsPostings(t *testing.T) {
+	dir := t.TempDir()
+	segmentDir, indexDir := filepath.Join(dir, "segments"), filepath.Join(dir, "index")
+
+	// aliases are indexed again on every run, after every doc
+	for _, freq := range []int{1, 2} {
+		b := NewBuilder()
+		b.AddAliases(3, map[string]int{"usa": freq})
+		b.AddAliases(5, map[string]int{"usa": freq})
+		if err := b.Flush(segmentDir); err != nil {
+			t.Fatal(err)
+		}
+		if err := Merge(segmentDir, indexDir, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := readTerm(t, indexDir, "usa", FieldAlias)
+	want := []Posting{{DocID: 3, Freq: 2}, {DocID: 5, Freq: 2}}
+	if !slices.EqualFunc(got, want, func(a, b Posting) bool { return a.DocID == b.DocID && a.Freq == b.Freq }) {
+		t.Errorf("usa aliases = %v, want %v", got, want)
+	}
+}
+
+func TestMergeSegmentsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	segmentDir, indexDir := filepath.Join(dir, "segments"), filepath.Join(dir, "index")
+
+	b := NewBuilder()
+	b.Add(0, map[string]int{"plant": 1, "zebra": 1}, nil, nil)
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(segmentDir, indexDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	// several segments merged at once, words spread across them
+	b.Add(1, map[string]int{"apple": 1, "plant": 2}, nil, nil)
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	b.Add(2, map[string]int{"zebra": 4}, nil, nil)
+	b.AddAliases(1, map[string]int{"plant": 1})
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	b.Add(3, map[string]int{"apple": 2, "plant": 1, "zebra": 1}, nil, nil)
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(segmentDir, indexDir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for term, want := range map[string][]uint32{
+		"apple": {1, 3},
+		"plant": {0, 1, 3},
+		"zebra": {0, 2, 3},
+	} {
+		if got := docIDs(readTerm(t, indexDir, term, FieldExact)); !slices.Equal(got, want) {
+			t.Errorf("%s docs = %v, want %v", term, got, want)
+		}
+	}
+	if got := docIDs(readTerm(t, indexDir, "plant", FieldAlias)); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("plant aliases = %v, want [1]", got)
+	}
+	segments, err := listSegments(segmentDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 0 {
+		t.Errorf("%d segments left after merging", len(segments))
+	}
+}
+
+func TestMergeMixedPositions(t *testing.T) {
+	dir := t.TempDir()
+	segmentDir, indexDir := filepath.Join(dir, "segments"), filepath.Join(dir, "index")
+
+	b := NewBuilder()
+	b.Add(0, map[string]int{"plant": 1}, nil, map[string][]uint32{"plant": {3}})
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(segmentDir, indexDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	// a later run without -positions, the word that can't be merged is
+	// skipped and the rest still are
+	b.Add(1, map[string]int{"plant": 1, "soil": 1}, nil, nil)
+	if err := b.Flush(segmentDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Merge(segmentDir, indexDir, nil); err != nil {
+		t.Fatalf("Merge() = %v", err)
+	}
+	if got := readTerm(t, indexDir, "plant", FieldExact); len(got) != 1 || !slices.Equal(got[0].Positions, []uint32{3}) {
+		t.Errorf("plant postings = %v, want doc 0's untouched", got)
+	}
+	if got := docIDs(readTerm(t, indexDir, "soil", FieldExact)); !slices.Equal(got, []uint32{1}) {
+		t.Errorf("soil docs = %v, want [1]", got)
+	}
+}
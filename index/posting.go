@@ -0,0 +1,334 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Word index files start with postingMagic and a format version byte,
+// followed by the number of posting lists. Each list is a field byte, a flags
+// byte, the number of postings (the word's document
+// frequency in that field), the byte length of the encoded postings and then
+// the postings themselves as uvarint pairs of doc ID delta and word frequency,
+// ordered by doc ID. Lists flagged with listHasPositions follow each pair with
+// the delta encoded positions of the word in the doc.
+const (
+	postingMagic   = "W4DP"
+	PostingVersion = 2
+)
+
+const listHasPositions = 1 << 0
+
+var ErrPostingFormat = errors.New("unsupported posting file format")
+
+// ErrMixedPositions is returned for a posting list where only some postings
+// have positions, like one merging runs with and without -positions.
+var ErrMixedPositions = errors.New("posting list mixes postings with and without positions")
+
+// Field says which part of a page a posting list was built from.
+type Field uint8
+
+const (
+	FieldExact Field = iota
+	FieldStemmed
+	FieldAlias // the titles of redirects to the page
+	FieldTitle
+	FieldTitleStemmed
+	// FieldInfobox postings are for InfoboxTerms, the words of a page's
+	// infobox values under the field's key
+	FieldInfobox
+)
+
+// InfoboxTerm is the term an infobox value's word is indexed under, the
+// field's key and the word, like birth_place.london.
+func InfoboxTerm(key, word string) string {
+	return key + "." + word
+}
+
+// Posting is a document's occurrences of a word in one field. Positions are
+// the word's token offsets in the doc, stopwords included, if the index was
+// built with them.
+type Posting struct {
+	DocID     uint32
+	Freq      uint32
+	Positions []uint32
+}
+
+// hasPositions reports whether the postings have positions, which has to be
+// all of them or none.
+func hasPositions(ps []Posting) (bool, error) {
+	var with int
+	for _, p := range ps {
+		if len(p.Positions) == 0 {
+			continue
+		}
+		if len(p.Positions) != int(p.Freq) {
+			return false, fmt.Errorf("%w: doc %d has %d positions for %d occurrences",
+				ErrMixedPositions, p.DocID, len(p.Positions), p.Freq)
+		}
+		with++
+	}
+	if with > 0 && with < len(ps) {
+		return false, fmt.Errorf("%w: %d of %d postings", ErrMixedPositions, with, len(ps))
+	}
+	return with > 0, nil
+}
+
+// appendPostings encodes ps, which must be ordered by doc ID, onto buf.
+func appendPostings(buf []byte, ps []Posting, withPositions bool) []byte {
+	var prev uint32
+	for _, p := range ps {
+		buf = binary.AppendUvarint(buf, uint64(p.DocID-prev))
+		buf = binary.AppendUvarint(buf, uint64(p.Freq))
+		prev = p.DocID
+		if !withPositions {
+			continue
+		}
+		var prevPos uint32
+		for _, pos := range p.Positions {
+			buf = binary.AppendUvarint(buf, uint64(pos-prevPos))
+			prevPos = pos
+		}
+	}
+	return buf
+}
+
+// appendList encodes a complete posting list, header included, onto buf.
+func appendList(buf []byte, field Field, ps []Posting) ([]byte, error) {
+	withPositions, err := hasPositions(ps)
+	if err != nil {
+		return nil, err
+	}
+	var flags byte
+	if withPositions {
+		flags |= listHasPositions
+	}
+	encoded := appendPostings(nil, ps, withPositions)
+	buf = append(buf, byte(field), flags)
+	buf = binary.AppendUvarint(buf, uint64(len(ps)))
+	buf = binary.AppendUvarint(buf, uint64(len(encoded)))
+	return append(buf, encoded...), nil
+}
+
+// EncodePostingFile builds the contents of a word index file, writing the
+// non-empty lists in field order.
+func EncodePostingFile(lists map[Field][]Posting) ([]byte, error) {
+	fields := make([]Field, 0, len(lists))
+	for field, ps := range lists {
+		if len(ps) > 0 {
+			fields = append(fields, field)
+		}
+	}
+	slices.Sort(fields)
+	buf := make([]byte, 0, 64)
+	buf = append(buf, postingMagic...)
+	buf = append(buf, PostingVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(fields)))
+	for _, field := range fields {
+		var err error
+		buf, err = appendList(buf, field, lists[field])
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s postings: %w", field, err)
+		}
+	}
+	return buf, nil
+}
+
+type listHeader struct {
+	field Field
+	flags byte
+	count int
+	data  []byte
+}
+
+// PostingFile is a decoded word index file. The posting lists are read
+// straight out of the file's bytes as they're iterated.
+type PostingFile struct {
+	lists []listHeader
+}
+
+func ReadPostingFile(path string) (*PostingFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read posting file: %w", err)
+	}
+	return DecodePostingFile(b)
+}
+
+func DecodePostingFile(b []byte) (*PostingFile, error) {
+	if !bytes.HasPrefix(b, []byte(postingMagic)) || len(b) < len(postingMagic)+1 {
+		return nil, fmt.Errorf("%w: bad magic", ErrPostingFormat)
+	}
+	version := b[len(postingMagic)]
+	if version != PostingVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrPostingFormat, version)
+	}
+	b = b[len(postingMagic)+1:]
+	numLists, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: bad list count", ErrPostingFormat)
+	}
+	b = b[n:]
+	pf := &PostingFile{lists: make([]listHeader, 0, numLists)}
+	for range numLists {
+		var l listHeader
+		var err error
+		l, b, err = decodeListHeader(b)
+		if err != nil {
+			return nil, err
+		}
+		pf.lists = append(pf.lists, l)
+	}
+	return pf, nil
+}
+
+// decodeListHeader reads one list off the front of b, returning the rest.
+func decodeListHeader(b []byte) (listHeader, []byte, error) {
+	if len(b) < 2 {
+		return listHeader{}, nil, fmt.Errorf("%w: truncated list header", ErrPostingFormat)
+	}
+	l := listHeader{field: Field(b[0]), flags: b[1]}
+	b = b[2:]
+	count, n := binary.Uvarint(b)
+	if n <= 0 {
+		return listHeader{}, nil, fmt.Errorf("%w: bad posting count", ErrPostingFormat)
+	}
+	l.count = int(count)
+	b = b[n:]
+	size, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < size {
+		return listHeader{}, nil, fmt.Errorf("%w: bad list size", ErrPostingFormat)
+	}
+	b = b[n:]
+	l.data = b[:size]
+	return l, b[size:], nil
+}
+
+func (l listHeader) iterator() PostingIterator {
+	return PostingIterator{data: l.data, count: l.count, positions: l.flags&listHasPositions != 0}
+}
+
+// List returns an iterator over the field's postings, which is empty if the
+// word doesn't occur in that field.
+func (pf *PostingFile) List(field Field) PostingIterator {
+	for _, l := range pf.lists {
+		if l.field == field {
+			return l.iterator()
+		}
+	}
+	return PostingIterator{}
+}
+
+// Postings decodes the whole of a field's list.
+func (pf *PostingFile) Postings(field Field) ([]Posting, error) {
+	it := pf.List(field)
+	ps := it.appendAll(make([]Posting, 0, it.Len()))
+	return ps, it.Err()
+}
+
+// PostingIterator walks a posting list without allocating.
+type PostingIterator struct {
+	data      []byte
+	count     int
+	positions bool
+	pos       int
+	posStart  int // where the current posting's positions start
+	doc       uint32
+	freq      uint32
+	err       error
+}
+
+// Len is the number of postings in the list.
+func (it *PostingIterator) Len() int { return it.count }
+
+// HasPositions reports whether the list records where the word occurs.
+func (it *PostingIterator) HasPositions() bool { return it.positions }
+
+func (it *PostingIterator) Next() bool {
+	if it.pos >= len(it.data) || it.err != nil {
+		return false
+	}
+	delta, n := binary.Uvarint(it.data[it.pos:])
+	if n <= 0 {
+		it.err = fmt.Errorf("%w: bad doc id", ErrPostingFormat)
+		return false
+	}
+	it.pos += n
+	freq, n := binary.Uvarint(it.data[it.pos:])
+	if n <= 0 {
+		it.err = fmt.Errorf("%w: bad frequency", ErrPostingFormat)
+		return false
+	}
+	it.pos += n
+	it.doc += uint32(delta)
+	it.freq = uint32(freq)
+	if it.positions {
+		it.posStart = it.pos
+		for range it.freq {
+			_, n := binary.Uvarint(it.data[it.pos:])
+			if n <= 0 {
+				it.err = fmt.Errorf("%w: bad position", ErrPostingFormat)
+				return false
+			}
+			it.pos += n
+		}
+	}
+	return true
+}
+
+func (it *PostingIterator) DocID() uint32 { return it.doc }
+func (it *PostingIterator) Freq() uint32  { return it.freq }
+
+// Positions appends the current posting's positions to buf, so callers can
+// reuse one buffer for the whole list.
+func (it *PostingIterator) Positions(buf []uint32) []uint32 {
+	if !it.positions {
+		return buf
+	}
+	var pos uint32
+	i := it.posStart
+	for range it.freq {
+		delta, n := binary.Uvarint(it.data[i:])
+		i += n
+		pos += uint32(delta)
+		buf = append(buf, pos)
+	}
+	return buf
+}
+
+// Err reports a decoding error that stopped the iteration early.
+func (it *PostingIterator) Err() error { return it.err }
+
+func (it *PostingIterator) appendAll(ps []Posting) []Posting {
+	for it.Next() {
+		p := Posting{DocID: it.DocID(), Freq: it.Freq()}
+		if it.positions {
+			p.Positions = it.Positions(make([]uint32, 0, it.freq))
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+func (f Field) String() string {
+	switch f {
+	case FieldExact:
+		return "text"
+	case FieldStemmed:
+		return "text_stemmed"
+	case FieldAlias:
+		return "alias"
+	case FieldTitle:
+		return "title"
+	case FieldTitleStemmed:
+		return "title_stemmed"
+	case FieldInfobox:
+		return "infobox"
+	default:
+		return fmt.Sprintf("field(%d)", f)
+	}
+}
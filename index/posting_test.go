@@ -0,0 +1,117 @@
+package index
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func samePostings(a, b []Posting) bool {
+	return slices.EqualFunc(a, b, func(a, b Posting) bool {
+		return a.DocID == b.DocID && a.Freq == b.Freq && slices.Equal(a.Positions, b.Positions)
+	})
+}
+
+func encodeTestFile(t *testing.T, lists map[Field][]Posting) []byte {
+	t.Helper()
+	b, err := EncodePostingFile(lists)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestPostingFileRoundTrip(t *testing.T) {
+	lists := map[Field][]Posting{
+		// doc IDs far apart take multi byte deltas
+		FieldExact:   {{DocID: 0, Freq: 1}, {DocID: 1, Freq: 300}, {DocID: 1 << 20, Freq: 2}, {DocID: 1<<32 - 1, Freq: 1}},
+		FieldTitle:   {{DocID: 7, Freq: 1}},
+		FieldInfobox: {{DocID: 3, Freq: 2}, {DocID: 9, Freq: 1}},
+		FieldAlias:   nil, // empty lists aren't written
+	}
+	b := encodeTestFile(t, lists)
+	if string(b[:len(postingMagic)]) != postingMagic || b[len(postingMagic)] != PostingVersion {
+		t.Fatalf("file starts %q, want %q and version %d", b[:len(postingMagic)+1], postingMagic, PostingVersion)
+	}
+	pf, err := DecodePostingFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pf.lists) != 3 {
+		t.Errorf("decoded %d lists, want 3", len(pf.lists))
+	}
+	for _, field := range []Field{FieldExact, FieldStemmed, FieldAlias, FieldTitle, FieldInfobox} {
+		got, err := pf.Postings(field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !samePostings(got, lists[field]) {
+			t.Errorf("%s postings = %v, want %v", field, got, lists[field])
+		}
+		if it := pf.List(field); it.Len() != len(lists[field]) || it.HasPositions() {
+			t.Errorf("%s list has %d postings, positions %t, want %d without", field, it.Len(), it.HasPositions(), len(lists[field]))
+		}
+	}
+}
+
+func TestPostingPositionsRoundTrip(t *testing.T) {
+	want := []Posting{
+		{DocID: 3, Freq: 2, Positions: []uint32{4, 90}},
+		{DocID: 8, Freq: 1, Positions: []uint32{0}},
+		{DocID: 1000, Freq: 3, Positions: []uint32{7, 8, 300}},
+	}
+	pf, err := DecodePostingFile(encodeTestFile(t, map[Field][]Posting{FieldExact: want}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := pf.List(FieldExact)
+	if !it.HasPositions() {
+		t.Fatal("list lost its positions")
+	}
+	var buf []uint32
+	for i := 0; it.Next(); i++ {
+		buf = it.Positions(buf[:0])
+		if it.DocID() != want[i].DocID || !slices.Equal(buf, want[i].Positions) {
+			t.Errorf("posting %d = doc %d at %v, want doc %d at %v", i, it.DocID(), buf, want[i].DocID, want[i].Positions)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodePostingFileMixedPositions(t *testing.T) {
+	tests := []struct {
+		name string
+		ps   []Posting
+	}{
+		{"one without", []Posting{{DocID: 1, Freq: 1, Positions: []uint32{2}}, {DocID: 2, Freq: 1}}},
+		{"one with", []Posting{{DocID: 1, Freq: 1}, {DocID: 2, Freq: 1, Positions: []uint32{2}}}},
+		{"too few", []Posting{{DocID: 1, Freq: 2, Positions: []uint32{2}}}},
+	}
+	for _, tt := range tests {
+		if _, err := EncodePostingFile(map[Field][]Posting{FieldExact: tt.ps}); !errors.Is(err, ErrMixedPositions) {
+			t.Errorf("%s: EncodePostingFile() = %v, want ErrMixedPositions", tt.name, err)
+		}
+	}
+}
+
+func TestDecodePostingFileErrors(t *testing.T) {
+	b := encodeTestFile(t, map[Field][]Posting{FieldExact: {{DocID: 1, Freq: 1}, {DocID: 5, Freq: 2}}})
+	tests := map[string][]byte{
+		"empty":     nil,
+		"bad magic": append([]byte("W4DX"), b[len(postingMagic):]...),
+		"no lists":  b[:len(postingMagic)+1],
+		"truncated": b[:len(b)-1],
+	}
+	for _, version := range []byte{0, 1, PostingVersion + 1} {
+		old := slices.Clone(b)
+		old[len(postingMagic)] = version
+		tests["version "+string('0'+rune(version))] = old
+	}
+	for name, b := range tests {
+		if _, err := DecodePostingFile(b); !errors.Is(err, ErrPostingFormat) {
+			t.Errorf("%s: DecodePostingFile() = %v, want ErrPostingFormat", name, err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+const priorFileName = "pagerank.f32"
+
+// WritePriors replaces the per-doc priors in dir, a little endian float32
+// for each doc ID.
+func WritePriors(dir string, priors []float32) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create priors dir: %w", err)
+	}
+	b := make([]byte, 0, len(priors)*4)
+	for _, p := range priors {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(p))
+	}
+	path := filepath.Join(dir, priorFileName)
+	if err := os.WriteFile(path+".tmp", b, 0644); err != nil {
+		return fmt.Errorf("failed to write priors: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to rename priors: %w", err)
+	}
+	return nil
+}
+
+// LoadPriors reads the per-doc priors in dir, indexed by doc ID. Priors that
+// were never computed are nil.
+func LoadPriors(dir string) ([]float32, error) {
+	b, err := os.ReadFile(filepath.Join(dir, priorFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read priors: %w", err)
+	}
+	priors := make([]float32, len(b)/4)
+	for i := range priors {
+		priors[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return priors, nil
+}
@@ -0,0 +1,24 @@
+package index
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPriors(t *testing.T) {
+	dir := t.TempDir()
+	priors, err := LoadPriors(dir)
+	if err != nil || priors != nil {
+		t.Fatalf("LoadPriors before any were written = %v, %v, want nil", priors, err)
+	}
+	want := []float32{1, 0, 0.25, 0.5}
+	if err := WritePriors(dir, want); err != nil {
+		t.Fatal(err)
+	}
+	if priors, err = LoadPriors(dir); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(priors, want) {
+		t.Errorf("LoadPriors = %v, want %v", priors, want)
+	}
+}
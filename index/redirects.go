@@ -0,0 +1,74 @@
+package index
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const redirectFileName = "redirects.jsonl"
+
+// Redirect is a redirect page, From is its title and To the title of the
+// page it points at. One with no To records that From stopped being a
+// redirect, overriding the ones before it.
+type Redirect struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RedirectTable is an append-only file of Redirects, a line of JSON each.
+type RedirectTable = appendLog[Redirect]
+
+func OpenRedirectTable(dir string) (*RedirectTable, error) {
+	return openAppendLog[Redirect](dir, redirectFileName, "redirect table")
+}
+
+// NormalizeTitle writes a title the way the wiki stores it, with spaces for
+// underscores and the first letter uppercase, so links like [[green_plants]]
+// find the redirect from Green plants.
+func NormalizeTitle(title string) string {
+	title = strings.TrimSpace(strings.ReplaceAll(title, "_", " "))
+	r, size := utf8.DecodeRuneInString(title)
+	if r == utf8.RuneError || unicode.IsUpper(r) {
+		return title
+	}
+	return string(unicode.ToUpper(r)) + title[size:]
+}
+
+// LoadRedirects reads the redirect table in dir into a map of source title
+// to target title, both normalized. A missing table has no redirects.
+func LoadRedirects(dir string) (map[string]string, error) {
+	redirects := map[string]string{}
+	err := readAppendLog(filepath.Join(dir, redirectFileName), "redirect table", func(r Redirect) error {
+		if r.To == "" {
+			delete(redirects, NormalizeTitle(r.From))
+			return nil
+		}
+		redirects[NormalizeTitle(r.From)] = NormalizeTitle(r.To)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return redirects, nil
+}
+
+// maxRedirectHops bounds how many redirects to redirects are followed, the
+// dumps have the odd loop.
+const maxRedirectHops = 5
+
+// ResolveRedirect follows title through the redirects loaded by
+// LoadRedirects to the page it ends at, which is title itself, normalized, if
+// it isn't a redirect.
+func ResolveRedirect(redirects map[string]string, title string) string {
+	title = NormalizeTitle(title)
+	for range maxRedirectHops {
+		target, ok := redirects[title]
+		if !ok {
+			break
+		}
+		title = target
+	}
+	return title
+}
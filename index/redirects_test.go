@@ -0,0 +1,76 @@
+package index
+
+import "testing"
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := map[string]string{
+		"Green plants":     "Green plants",
+		"green_plants":     "Green plants",
+		" green plants_ ":  "Green plants",
+		"ébène":            "Ébène",
+		"iPhone":           "IPhone",
+		"United_States_of": "United States of",
+		"":                 "",
+	}
+	for title, want := range tests {
+		if got := NormalizeTitle(title); got != want {
+			t.Errorf("NormalizeTitle(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestResolveRedirect(t *testing.T) {
+	dir := t.TempDir()
+	rt, err := OpenRedirectTable(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []Redirect{
+		{From: "Green plants", To: "Plant"},
+		{From: "Flora", To: "green_plants"}, // a redirect to a redirect
+		{From: "USA", To: "United States"},
+		{From: "Loop A", To: "Loop B"},
+		{From: "Loop B", To: "Loop A"},
+		{From: "Moss", To: "Plant"},
+		{From: "moss"}, // Moss became an article
+	} {
+		if err := rt.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rt.Close(); err != nil {
+		t.Fatal(err)
+	}
+	redirects, err := LoadRedirects(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"Green plants": "Plant",
+		"green_plants": "Plant",
+		"green plants": "Plant",
+		"flora":        "Plant",
+		"USA":          "United States",
+		"Plant":        "Plant",
+		"plant":        "Plant",
+		"Animal":       "Animal",
+		"Moss":         "Moss",
+	}
+	for title, want := range tests {
+		if got := ResolveRedirect(redirects, title); got != want {
+			t.Errorf("ResolveRedirect(%q) = %q, want %q", title, got, want)
+		}
+	}
+	// loops give up rather than spin
+	if got := ResolveRedirect(redirects, "Loop A"); got != "Loop A" && got != "Loop B" {
+		t.Errorf("ResolveRedirect(Loop A) = %q", got)
+	}
+}
+
+func TestLoadRedirectsMissingTable(t *testing.T) {
+	redirects, err := LoadRedirects(t.TempDir())
+	if err != nil || len(redirects) != 0 {
+		t.Errorf("LoadRedirects() = %v, %v, want no redirects", redirects, err)
+	}
+}
@@ -0,0 +1,176 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// The names of the slug indexes built from the link table.
+const (
+	BacklinkIndex = "backlinks"  // docs linking to the page with the slug
+	CategoryIndex = "categories" // docs in the category with the slug
+)
+
+// slugEntry is a line of a slug index's data file, the docs listed under the
+// slug.
+type slugEntry struct {
+	Slug string   `json:"slug"`
+	Docs []uint32 `json:"docs"`
+}
+
+// WriteSlugIndex replaces the slug index called name in dir with lists,
+// which maps slugs to doc IDs, like the slug of a page to the docs linking to
+// it. Entries are written sorted by slug to name.jsonl with an offset file,
+// name.off, alongside so SlugIndex can binary search them without loading
+// the file.
+func WriteSlugIndex(dir, name string, lists map[string][]uint32) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s dir: %w", name, err)
+	}
+	slugs := make([]string, 0, len(lists))
+	for slug := range lists {
+		slugs = append(slugs, slug)
+	}
+	slices.Sort(slugs)
+
+	// written to temp files and renamed, so a reader never sees half an index
+	dataPath := filepath.Join(dir, name+".jsonl")
+	offPath := filepath.Join(dir, name+".off")
+	data, err := os.Create(dataPath + ".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create %s data: %w", name, err)
+	}
+	defer func() { _ = data.Close() }()
+	off, err := os.Create(offPath + ".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create %s offsets: %w", name, err)
+	}
+	defer func() { _ = off.Close() }()
+
+	dataW, offW := bufio.NewWriterSize(data, 1024*1024), bufio.NewWriter(off)
+	var size uint64
+	for _, slug := range slugs {
+		docs := lists[slug]
+		slices.Sort(docs)
+		b, err := json.Marshal(slugEntry{Slug: slug, Docs: slices.Compact(docs)})
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", name, err)
+		}
+		b = append(b, '\n')
+		if _, err := dataW.Write(b); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		if _, err := offW.Write(binary.LittleEndian.AppendUint64(nil, size)); err != nil {
+			return fmt.Errorf("failed to write %s offset: %w", name, err)
+		}
+		size += uint64(len(b))
+	}
+	for _, f := range []struct {
+		w  *bufio.Writer
+		fh *os.File
+	}{{dataW, data}, {offW, off}} {
+		if err := f.w.Flush(); err != nil {
+			return fmt.Errorf("failed to flush %s: %w", name, err)
+		}
+		if err := f.fh.Sync(); err != nil {
+			return fmt.Errorf("failed to sync %s: %w", name, err)
+		}
+	}
+	// a crash between the renames leaves the index unmarked as built in the
+	// checkpoint, so it's written again
+	if err := os.Rename(dataPath+".tmp", dataPath); err != nil {
+		return fmt.Errorf("failed to rename %s data: %w", name, err)
+	}
+	if err := os.Rename(offPath+".tmp", offPath); err != nil {
+		return fmt.Errorf("failed to rename %s offsets: %w", name, err)
+	}
+	return nil
+}
+
+// SlugIndex looks up the docs listed under a slug in an index written by
+// WriteSlugIndex.
+type SlugIndex struct {
+	data    *os.File
+	offsets []uint64
+	size    uint64
+}
+
+// OpenSlugIndex opens the slug index called name in dir. An index that was
+// never built is empty.
+func OpenSlugIndex(dir, name string) (*SlugIndex, error) {
+	offBytes, err := os.ReadFile(filepath.Join(dir, name+".off"))
+	if errors.Is(err, os.ErrNotExist) {
+		return &SlugIndex{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s offsets: %w", name, err)
+	}
+	data, err := os.Open(filepath.Join(dir, name+".jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s data: %w", name, err)
+	}
+	fi, err := data.Stat()
+	if err != nil {
+		_ = data.Close()
+		return nil, fmt.Errorf("failed to stat %s data: %w", name, err)
+	}
+	si := &SlugIndex{data: data, offsets: make([]uint64, len(offBytes)/8), size: uint64(fi.Size())}
+	for i := range si.offsets {
+		si.offsets[i] = binary.LittleEndian.Uint64(offBytes[i*8:])
+	}
+	return si, nil
+}
+
+// Get returns the IDs of the docs listed under the slug, in doc ID order.
+func (si *SlugIndex) Get(slug string) ([]uint32, error) {
+	lo, hi := 0, len(si.offsets)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		entry, err := si.entry(mid)
+		if err != nil {
+			return nil, err
+		}
+		switch c := strings.Compare(entry.Slug, slug); {
+		case c == 0:
+			return entry.Docs, nil
+		case c < 0:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+	return nil, nil
+}
+
+func (si *SlugIndex) entry(i int) (slugEntry, error) {
+	start, end := si.offsets[i], si.size
+	if i+1 < len(si.offsets) {
+		end = si.offsets[i+1]
+	}
+	b := make([]byte, end-start)
+	if _, err := si.data.ReadAt(b, int64(start)); err != nil && !errors.Is(err, io.EOF) {
+		return slugEntry{}, fmt.Errorf("failed to read slug index entry %d: %w", i, err)
+	}
+	b, _, _ = bytes.Cut(b, []byte("\n"))
+	var entry slugEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return slugEntry{}, fmt.Errorf("failed to unmarshal slug index entry %d: %w", i, err)
+	}
+	return entry, nil
+}
+
+func (si *SlugIndex) Close() error {
+	if si.data == nil {
+		return nil
+	}
+	return si.data.Close()
+}
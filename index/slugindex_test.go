@@ -0,0 +1,123 @@
+package index
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestSlugIndex(t *testing.T) {
+	dir := t.TempDir()
+	lists := map[string][]uint32{
+		"plant": {9, 2, 2, 5}, // sorted and deduplicated when written
+		"fern":  {1},
+		"moss":  {},
+	}
+	for i := range 50 {
+		lists[fmt.Sprintf("page-%02d", i)] = []uint32{uint32(i)}
+	}
+	if err := WriteSlugIndex(dir, BacklinkIndex, lists); err != nil {
+		t.Fatal(err)
+	}
+	si, err := OpenSlugIndex(dir, BacklinkIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = si.Close() }()
+
+	for slug, want := range map[string][]uint32{
+		"plant":   {2, 5, 9},
+		"fern":    {1},
+		"moss":    {},
+		"page-00": {0},
+		"page-49": {49},
+		"animal":  nil,
+		"zebra":   nil,
+	} {
+		got, err := si.Get(slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) || (want == nil) != (got == nil) {
+			t.Errorf("Get(%s) = %v, want %v", slug, got, want)
+		}
+	}
+}
+
+func TestSlugIndexRewritten(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteSlugIndex(dir, CategoryIndex, map[string][]uint32{"plants": {1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSlugIndex(dir, CategoryIndex, map[string][]uint32{"ferns": {3}}); err != nil {
+		t.Fatal(err)
+	}
+	si, err := OpenSlugIndex(dir, CategoryIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = si.Close() }()
+	if got, _ := si.Get("plants"); got != nil {
+		t.Errorf("Get(plants) = %v after the index was rewritten without it", got)
+	}
+	if got, _ := si.Get("ferns"); !slices.Equal(got, []uint32{3}) {
+		t.Errorf("Get(ferns) = %v, want [3]", got)
+	}
+}
+
+func TestSlugIndexNeverBuilt(t *testing.T) {
+	si, err := OpenSlugIndex(t.TempDir(), BacklinkIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := si.Get("plant"); got != nil || err != nil {
+		t.Errorf("Get(plant) = %v, %v, want nothing", got, err)
+	}
+	if err := si.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLinkTable(t *testing.T) {
+	dir := t.TempDir()
+	lt, err := OpenLinkTable(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PageLinks{
+		{DocID: 0, To: []string{"Plant", "Deer"}, Categories: []string{"Ferns"}},
+		{DocID: 1, To: []string{}},
+	}
+	for _, l := range want {
+		if err := lt.Append(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lt.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	size := lt.Size()
+	// links past a checkpoint are rolled back
+	if err := lt.Append(PageLinks{DocID: 2, To: []string{"Moss"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lt.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	if err := lt.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []PageLinks
+	if err := ReadLinks(dir, func(l PageLinks) error { got = append(got, l); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d links, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].DocID != want[i].DocID || !slices.Equal(got[i].To, want[i].To) || !slices.Equal(got[i].Categories, want[i].Categories) {
+			t.Errorf("links %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/normalize"
+	"github.com/samiam2013/wiki4dummies/wiki"
+)
+
+// pagesPerChunk is how many pages the sequential reader hands to a worker at
+// once, roughly the size of one multistream stream.
+const pagesPerChunk = 100
+
+// chunk is a unit of work for the ingest workers. For multistream dumps it is
+// one bz2 stream, otherwise a run of pages read from the single reader.
+type chunk struct {
+	// nextOffset is where the stream after this one starts, -1 when not
+	// reading a multistream dump
+	nextOffset int64
+	load       func() ([][]byte, error)
+}
+
+type parsedPage struct {
+	title            string
+	raw              []byte
+	doc              index.Doc // everything but the RelPath, known once saved
+	wordFreqs        map[string]int
+	stemmedWordFreqs map[string]int
+	titleWordFreqs   map[string]int
+	positions        map[string][]uint32
+	links            []string
+	categories       []string
+	infobox          *wiki.Infobox
+	infoboxTerms     map[string]int // index.InfoboxTerm to frequency
+}
+
+// parseOptions controls what the workers extract from each page.
+type parseOptions struct {
+	positions  bool // record where each word occurs, for phrase queries
+	manifest   index.Manifest
+	namespaces map[int]struct{} // the keys of the namespaces to index
+	// docs has the revisions already indexed, which aren't parsed again
+	docs *index.DocTable
+	// savePath is where the pages of docs were saved
+	savePath string
+}
+
+type chunkResult struct {
+	chunk      chunk
+	pages      []parsedPage
+	redirects  []index.Redirect
+	lastPageID int64 // highest page ID in the chunk, including skipped pages
+	unchanged  int   // pages skipped because their revision is indexed
+	// removed are tombstones of the docs of pages that aren't indexed
+	// anymore
+	removed []index.Doc
+	// staleTerms are the terms, by field, of the docs superseded by the
+	// chunk's pages and tombstones
+	staleTerms map[index.Field][]string
+	err        error
+}
+
+// ingest loads and parses chunks across the worker pool and hands the results
+// to commit one at a time, in the order the chunks were received.
+func ingest(ctx context.Context, chunks <-chan chunk, workers int, opts parseOptions,
+	commit func(chunkResult) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type job struct {
+		c   chunk
+		res chan<- chunkResult
+	}
+	jobs := make(chan job)
+	ordered := make(chan chan chunkResult, 2*workers)
+
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+		for c := range chunks {
+			res := make(chan chunkResult, 1)
+			select {
+			case ordered <- res:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- job{c: c, res: res}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	for range workers {
+		wg.Go(func() {
+			for j := range jobs {
+				j.res <- processChunk(j.c, opts)
+			}
+		})
+	}
+	defer wg.Wait()
+
+	for res := range ordered {
+		var r chunkResult
+		select {
+		case r = <-res:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if r.err != nil {
+			return fmt.Errorf("failed to process chunk: %w", r.err)
+		}
+		if err := commit(r); err != nil {
+			return fmt.Errorf("failed to commit chunk: %w", err)
+		}
+	}
+	return ctx.Err()
+}
+
+// processChunk does the CPU heavy work for a chunk: decompressing, parsing the
+// wikitext and counting words.
+func processChunk(c chunk, opts parseOptions) chunkResult {
+	rawPages, err := c.load()
+	if err != nil {
+		return chunkResult{chunk: c, err: err}
+	}
+	pages := make([]parsedPage, 0, len(rawPages))
+	var redirects []index.Redirect
+	var lastPageID int64
+	unchanged := 0
+	var removed []index.Doc
+	staleTerms := map[index.Field][]string{}
+	for _, raw := range rawPages {
+		id, err := wiki.PageID(raw)
+		if err != nil {
+			return chunkResult{chunk: c, err: err}
+		}
+		lastPageID = max(lastPageID, id)
+		raw = wiki.LastRevision(raw)
+		page, art, err := parsePage(raw, opts)
+		if errors.Is(err, ErrNonArticlePage) && opts.docs != nil {
+			tombstone, ok, err := removedPage(opts.docs, page)
+			if err != nil {
+				return chunkResult{chunk: c, err: err}
+			}
+			if ok {
+				removed = append(removed, tombstone)
+				addStaleTerms(staleTerms, tombstone.PageID, opts)
+			}
+		}
+		if errors.Is(err, ErrRedirectPage) {
+			// links to a section redirect to the whole page
+			target, _, _ := strings.Cut(page.Redirect.Title, "#")
+			redirects = append(redirects, index.Redirect{From: page.Title, To: target})
+			continue
+		}
+		if errors.Is(err, ErrUnchangedPage) {
+			unchanged++
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, ErrNonArticlePage) {
+				slog.Error("Failed to parse page", "error", err)
+			}
+			continue
+		}
+		pp, err := newParsedPage(page, raw, id, art, opts.positions)
+		if err != nil {
+			slog.Error("Failed to index page", "title", page.Title, "error", err)
+			continue
+		}
+		if opts.docs != nil {
+			addStaleTerms(staleTerms, id, opts)
+		}
+		pages = append(pages, pp)
+	}
+	return chunkResult{
+		chunk:      c,
+		pages:      pages,
+		redirects:  redirects,
+		lastPageID: lastPageID,
+		unchanged:  unchanged,
+		removed:    removed,
+		staleTerms: staleTerms,
+	}
+}
+
+// addStaleTerms adds the terms the page's latest doc was indexed under, if it
+// was indexed, to terms. Without them the doc's postings are still dropped
+// from the word files the page's new doc rewrites, the rest only filtered out
+// when searching.
+func addStaleTerms(terms map[index.Field][]string, pageID int64, opts parseOptions) {
+	docID, ok := opts.docs.Lookup(pageID)
+	if !ok {
+		return
+	}
+	doc, err := opts.docs.Get(docID)
+	if err != nil {
+		slog.Warn("Failed to get replaced doc", "page_id", pageID, "error", err)
+		return
+	}
+	if doc.Deleted {
+		return
+	}
+	raw, err := os.ReadFile(filepath.Join(opts.savePath, constants.PageFileFolder, doc.RelPath))
+	if err != nil {
+		slog.Warn("Failed to read back replaced page", "title", doc.Title, "error", err)
+		return
+	}
+	opts.docs = nil
+	// its namespace was indexed when it was saved
+	opts.namespaces = map[int]struct{}{doc.Namespace: {}}
+	page, art, err := parsePage(raw, opts)
+	if err != nil {
+		slog.Warn("Failed to parse replaced page", "title", doc.Title, "error", err)
+		return
+	}
+	pp, err := newParsedPage(page, raw, doc.PageID, art, false)
+	if err != nil {
+		slog.Warn("Failed to index replaced page", "title", doc.Title, "error", err)
+		return
+	}
+	for field, freqs := range map[index.Field]map[string]int{
+		index.FieldExact:        pp.wordFreqs,
+		index.FieldStemmed:      pp.stemmedWordFreqs,
+		index.FieldTitle:        pp.titleWordFreqs,
+		index.FieldTitleStemmed: normalize.StemmedWordFreqs(pp.titleWordFreqs),
+		index.FieldInfobox:      pp.infoboxTerms,
+	} {
+		terms[field] = slices.AppendSeq(terms[field], maps.Keys(freqs))
+	}
+}
+
+// newParsedPage gathers the words of a parsed page the index is built from.
+func newParsedPage(page wiki.Page, raw []byte, id int64, art article, positions bool) (parsedPage, error) {
+	// coalesce abstract and text
+	text := art.text
+	if text == "" {
+		text = art.abstract
+	}
+	wordFreqs, err := wiki.GatherWordFrequency(strings.NewReader(text))
+	if err != nil {
+		return parsedPage{}, fmt.Errorf("failed to gather word frequency: %w", err)
+	}
+	pp := parsedPage{
+		title:            page.Title,
+		raw:              raw,
+		doc:              pageDoc(page, id, art.abstract, text, wordFreqs),
+		wordFreqs:        wordFreqs,
+		stemmedWordFreqs: normalize.StemmedWordFreqs(wordFreqs),
+		links:            art.links,
+		categories:       art.categories,
+	}
+	pp.titleWordFreqs, err = wiki.GatherWordFrequency(strings.NewReader(page.Title))
+	if err != nil {
+		return parsedPage{}, fmt.Errorf("failed to gather title word frequency: %w", err)
+	}
+	if positions {
+		pp.positions = wiki.WordPositions(text)
+	}
+	if pp.infobox = wiki.ParseInfobox(page.Revision.Text.Text); pp.infobox != nil {
+		pp.infoboxTerms, err = infoboxTerms(pp.infobox)
+		if err != nil {
+			return parsedPage{}, fmt.Errorf("failed to gather infobox words: %w", err)
+		}
+	}
+	return pp, nil
+}
+
+// infoboxTerms is the frequency of every word of the infobox's values, as
+// the index.InfoboxTerm of the field it's in.
+func infoboxTerms(ib *wiki.Infobox) (map[string]int, error) {
+	terms := map[string]int{}
+	for _, f := range ib.Fields {
+		key := normalize.InfoboxKey(f.Name)
+		if key == "" {
+			continue
+		}
+		wordFreqs, err := wiki.GatherWordFrequency(strings.NewReader(f.Text))
+		if err != nil {
+			return nil, err
+		}
+		for word, freq := range wordFreqs {
+			terms[index.InfoboxTerm(key, word)] += freq
+		}
+	}
+	return terms, nil
+}
+
+// maxAbstractLen caps the abstract stored in the doc table, which is used for
+// result snippets and AI answers rather than reading.
+const maxAbstractLen = 2000
+
+func pageDoc(page wiki.Page, pageID int64, abstract, text string, wordFreqs map[string]int) index.Doc {
+	doc := index.Doc{
+		Title:    page.Title,
+		PageID:   pageID,
+		ByteLen:  len(page.Revision.Text.Text),
+		Abstract: abstract,
+	}
+	// all were already validated as numbers by the dump's schema, a zero
+	// value is as good as an error here
+	doc.Namespace, _ = strconv.Atoi(page.Ns)
+	doc.RevisionID, _ = strconv.ParseInt(page.Revision.ID, 10, 64)
+	doc.SHA1 = page.Revision.Sha1
+	doc.Timestamp, _ = time.Parse(time.RFC3339, page.Revision.Timestamp)
+	for _, freq := range wordFreqs {
+		doc.TokenCount += freq
+	}
+	if doc.Abstract == "" {
+		doc.Abstract = text
+	}
+	if len(doc.Abstract) > maxAbstractLen {
+		// back up to a rune boundary for the abstracts without spaces
+		cut := maxAbstractLen
+		for cut > 0 && !utf8.RuneStart(doc.Abstract[cut]) {
+			cut--
+		}
+		doc.Abstract = doc.Abstract[:cut]
+		if lastSpace := strings.LastIndex(doc.Abstract, " "); lastSpace > 0 {
+			doc.Abstract = doc.Abstract[:lastSpace]
+		}
+		doc.Abstract += "..."
+	}
+	return doc
+}
+
+// scanPages calls fn with the buffer of every <page> element in r.
+func scanPages(r io.Reader, fn func(page []byte) error) error {
+	s := bufio.NewScanner(r)
+	// this is an insane size, unsure this is necessary
+	s.Buffer(make([]byte, 0, 64*1024), 100*1024*1024)
+
+	pageSection := false
+	pageBuffer := make([]byte, 0, 10*1024*1024)
+	for s.Scan() {
+		line := s.Bytes()
+		if bytes.Contains(line, []byte("<page>")) {
+			pageSection = true
+		}
+		if pageSection {
+			pageBuffer = append(pageBuffer, append(line, []byte("\n")...)...)
+		}
+		if bytes.Contains(line, []byte("</page>")) {
+			pageSection = false
+			if err := fn(append([]byte(nil), pageBuffer...)); err != nil {
+				return err
+			}
+			pageBuffer = pageBuffer[:0]
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("failed to scan dump: %w", err)
+	}
+	return nil
+}
+
+// sequentialChunks reads the whole dump through one decompressor, batching
+// pages into chunks so the parsing can still happen in parallel. Pages up to
+// and including afterPageID are dropped, dumps are ordered by page ID.
+func sequentialChunks(ctx context.Context, r io.Reader, afterPageID int64) (<-chan chunk, <-chan error) {
+	chunks := make(chan chunk)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		defer close(errc)
+		batch := make([][]byte, 0, pagesPerChunk)
+		send := func() error {
+			pages := batch
+			c := chunk{nextOffset: -1, load: func() ([][]byte, error) { return pages, nil }}
+			batch = make([][]byte, 0, pagesPerChunk)
+			select {
+			case chunks <- c:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		err := scanPages(r, func(page []byte) error {
+			if afterPageID > 0 {
+				id, err := wiki.PageID(page)
+				if err != nil {
+					return err
+				}
+				if id <= afterPageID {
+					return nil
+				}
+			}
+			batch = append(batch, page)
+			if len(batch) < pagesPerChunk {
+				return nil
+			}
+			return send()
+		})
+		if err == nil && len(batch) > 0 {
+			err = send()
+		}
+		errc <- err
+	}()
+	return chunks, errc
+}
+
+// multistreamChunks makes a chunk of every stream in the dump, each of which
+// is decompressed independently by whichever worker picks it up.
+func multistreamChunks(ctx context.Context, fh *os.File, offsets []int64) (<-chan chunk, error) {
+	fi, err := fh.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat dump file: %w", err)
+	}
+	chunks := make(chan chunk)
+	go func() {
+		defer close(chunks)
+		for i, offset := range offsets {
+			end := fi.Size()
+			if i+1 < len(offsets) {
+				end = offsets[i+1]
+			}
+			c := chunk{nextOffset: end, load: func() ([][]byte, error) {
+				section := io.NewSectionReader(fh, offset, end-offset)
+				pages := make([][]byte, 0, pagesPerChunk)
+				err := scanPages(bzip2.NewReader(section), func(page []byte) error {
+					pages = append(pages, page)
+					return nil
+				})
+				if err != nil {
+					return nil, fmt.Errorf("failed to read stream at offset %d: %w", offset, err)
+				}
+				return pages, nil
+			}}
+			select {
+			case chunks <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return chunks, nil
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/wiki"
+)
+
+// testManifest is a wiki with articles, talk pages and categories.
+var testManifest = index.Manifest{
+	Build:  index.CurrentBuild(),
+	DBName: "testwiki",
+	Namespaces: []index.Namespace{
+		{Key: 0},
+		{Key: 1, Name: "Talk"},
+		{Key: 14, Name: "Category"},
+	},
+}
+
+// testRevision is a revision of a page as it appears in a dump.
+type testRevision struct {
+	id       int64
+	ns       int
+	title    string
+	redirect string // the title redirected to, empty if it isn't a redirect
+	text     string
+}
+
+// xml is the revision as a <page> element, with a made up hash of its text.
+func (r testRevision) xml(pageID int64) []byte {
+	return historyXML(pageID, r)
+}
+
+// historyXML is a <page> element with every revision, as in a history dump.
+// The page's title, namespace and redirect are the last revision's.
+func historyXML(pageID int64, revs ...testRevision) []byte {
+	last := revs[len(revs)-1]
+	redirect := ""
+	if last.redirect != "" {
+		redirect = fmt.Sprintf("    <redirect title=\"%s\" />\n", html.EscapeString(last.redirect))
+	}
+	b := fmt.Appendf(nil, `<page>
+    <title>%s</title>
+    <ns>%d</ns>
+    <id>%d</id>
+%s`, html.EscapeString(last.title), last.ns, pageID, redirect)
+	for _, r := range revs {
+		b = fmt.Appendf(b, `    <revision>
+      <id>%d</id>
+      <timestamp>2024-10-01T00:00:00Z</timestamp>
+      <text bytes="%d" xml:space="preserve">%s</text>
+      <sha1>sha%d%x</sha1>
+    </revision>
+`, r.id, len(r.text), html.EscapeString(r.text), r.id, r.text)
+	}
+	return append(b, "  </page>\n"...)
+}
+
+// articleOptions parse the articles of testManifest.
+func articleOptions() parseOptions {
+	return parseOptions{manifest: testManifest, namespaces: map[int]struct{}{0: {}}}
+}
+
+func TestParsePageLinks(t *testing.T) {
+	rev := testRevision{id: 10, title: "Fern", text: `A '''fern''' is a [[plant]] without [[flower|flowers]].
+Like other [[Plant]]s, see [[#Uses|uses]], [[Talk:Fern]], [[:Category:Plants]] and [[File:Fern.jpg|thumb]].
+
+== Uses ==
+Ferns are [[plant]] food for [[Deer]].
+[[Category:Plants]]
+[[Category:Ferns|*]]`}
+	page, art, err := parsePage(rev.xml(1), articleOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "Fern" {
+		t.Errorf("title = %q", page.Title)
+	}
+	if want := []string{"Plant", "Flower", "Deer"}; !slices.Equal(art.links, want) {
+		t.Errorf("links = %q, want %q", art.links, want)
+	}
+	if want := []string{"Plants", "Ferns"}; !slices.Equal(art.categories, want) {
+		t.Errorf("categories = %q, want %q", art.categories, want)
+	}
+}
+
+func TestParsePageInfobox(t *testing.T) {
+	rev := testRevision{id: 10, title: "Nile", text: `{{Infobox river
+| name = Nile
+| Source location = [[Lake Victoria]], Uganda
+| length = 6650 km
+| 1 = skipped
+| ! = no key
+}}
+The '''Nile''' is a river in Africa.`}
+	page, art, err := parsePage(rev.xml(1), articleOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp, err := newParsedPage(page, rev.xml(1), 1, art, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pp.infobox == nil || pp.infobox.Type != "river" || len(pp.infobox.Fields) != 5 {
+		t.Fatalf("infobox = %+v", pp.infobox)
+	}
+	want := map[string]int{
+		"name.nile":                1,
+		"source_location.lake":     1,
+		"source_location.victoria": 1,
+		"source_location.uganda":   1,
+		"length.km":                1, // numbers are never words
+		"1.skipped":                1,
+	}
+	if !maps.Equal(pp.infoboxTerms, want) {
+		t.Errorf("infobox terms = %v, want %v", pp.infoboxTerms, want)
+	}
+	// the infobox isn't part of the article text
+	if _, ok := pp.wordFreqs["uganda"]; ok {
+		t.Errorf("word frequencies %v include the infobox", pp.wordFreqs)
+	}
+	if pp.wordFreqs["nile"] != 1 || pp.wordFreqs["africa"] != 1 {
+		t.Errorf("word frequencies = %v, want the article text", pp.wordFreqs)
+	}
+}
+
+func TestPageDocAbstract(t *testing.T) {
+	// a language written without spaces, in runes of 3 bytes
+	text := strings.Repeat("植物", maxAbstractLen)
+	doc := pageDoc(wiki.Page{Title: "植物"}, 1, "", text, nil)
+	if !utf8.ValidString(doc.Abstract) {
+		t.Errorf("abstract %q was cut inside a rune", doc.Abstract[len(doc.Abstract)-8:])
+	}
+	if !strings.HasSuffix(doc.Abstract, "...") || len(doc.Abstract) > maxAbstractLen+len("...") {
+		t.Errorf("abstract of %d bytes, want at most %d ending in ...", len(doc.Abstract), maxAbstractLen+len("..."))
+	}
+}
+
+func TestParsePageNamespaces(t *testing.T) {
+	talk := testRevision{id: 10, ns: 1, title: "Talk:Fern", text: "Is a [[fern]] a plant?"}
+	if _, _, err := parsePage(talk.xml(1), articleOptions()); !errors.Is(err, ErrNonArticlePage) {
+		t.Errorf("parsePage of a talk page = %v, want ErrNonArticlePage", err)
+	}
+	opts := articleOptions()
+	opts.namespaces = map[int]struct{}{0: {}, 1: {}}
+	page, art, err := parsePage(talk.xml(1), opts)
+	if err != nil {
+		t.Fatalf("parsePage of a talk page with talk pages indexed = %v", err)
+	}
+	if page.Title != "Talk:Fern" || !slices.Equal(art.links, []string{"Fern"}) {
+		t.Errorf("page %q links = %q", page.Title, art.links)
+	}
+	pp, err := newParsedPage(page, talk.xml(1), 1, art, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pp.doc.Namespace != 1 {
+		t.Errorf("doc namespace = %d, want 1", pp.doc.Namespace)
+	}
+
+	unknown := testRevision{id: 11, ns: 2, title: "User:Fern", text: "Hello."}
+	if _, _, err := parsePage(unknown.xml(2), opts); err == nil || errors.Is(err, ErrNonArticlePage) {
+		t.Errorf("parsePage of a page in a namespace the wiki doesn't have = %v", err)
+	}
+}
+
+// indexRevisions saves each revision under savePath and adds its doc to the
+// doc table the way the indexer would, keyed by page ID.
+func indexRevisions(t *testing.T, savePath string, docs *index.DocTable, revs map[int64]testRevision) {
+	t.Helper()
+	for _, pageID := range slices.Sorted(maps.Keys(revs)) {
+		raw := revs[pageID].xml(pageID)
+		page, art, err := parsePage(raw, articleOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pp, err := newParsedPage(page, raw, pageID, art, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pp.doc.RelPath, err = savePage(savePath, pp.title, raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := docs.Append(pp.doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testChunk is a chunk of the raw pages.
+func testChunk(pages ...[]byte) chunk {
+	return chunk{nextOffset: -1, load: func() ([][]byte, error) { return pages, nil }}
+}
+
+func TestProcessChunkSkipsIndexedRevisions(t *testing.T) {
+	dir := t.TempDir()
+	docs := writeTestTables(t, dir, nil, nil, nil)
+	indexRevisions(t, dir, docs, map[int64]testRevision{
+		1: {id: 10, title: "Fern", text: "A fern is a plant."},
+		2: {id: 20, title: "Moss", text: "Moss is a plant."},
+		3: {id: 30, title: "Tree", text: "A tree is a tall plant."},
+		4: {id: 40, title: "Rose", text: "A rose has thorns."},
+	})
+	opts := articleOptions()
+	opts.docs = docs
+	res := processChunk(testChunk(
+		testRevision{id: 10, title: "Fern", text: "A fern is a plant."}.xml(1),    // already indexed
+		testRevision{id: 21, title: "Moss", text: "Moss grows on rocks."}.xml(2),  // edited since
+		testRevision{id: 29, title: "Tree", text: "An older tree."}.xml(3),        // older than indexed
+		testRevision{id: 40, title: "Roses", text: "A rose has thorns."}.xml(4),   // moved, same revision
+		testRevision{id: 50, title: "Tulip", text: "A tulip is a flower."}.xml(5), // new
+	), opts)
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if res.unchanged != 2 || res.lastPageID != 5 {
+		t.Errorf("%d unchanged, last page ID %d, want 2 and 5", res.unchanged, res.lastPageID)
+	}
+	var titles []string
+	for _, pp := range res.pages {
+		titles = append(titles, pp.title)
+	}
+	if want := []string{"Moss", "Roses", "Tulip"}; !slices.Equal(titles, want) {
+		t.Errorf("pages to index = %v, want %v", titles, want)
+	}
+	if moss := res.pages[0].doc; moss.PageID != 2 || moss.RevisionID != 21 || moss.SHA1 == "" {
+		t.Errorf("Moss doc = %+v, want revision 21 of page 2 with its hash", moss)
+	}
+}
+
+func TestProcessChunkTombstones(t *testing.T) {
+	dir := t.TempDir()
+	docs := writeTestTables(t, dir, nil, nil, nil)
+	indexRevisions(t, dir, docs, map[int64]testRevision{
+		1: {id: 10, title: "Fern", text: "A fern is a plant."},
+		2: {id: 20, title: "Moss", text: "Moss is a plant."},
+		3: {id: 30, title: "Tree", text: "A tree is a tall plant."},
+	})
+	opts := articleOptions()
+	opts.docs = docs
+	res := processChunk(testChunk(
+		testRevision{id: 11, title: "Fern", redirect: "Ferns"}.xml(1),                  // now a redirect
+		testRevision{id: 21, ns: 1, title: "Talk:Moss", text: "Moss?"}.xml(2),          // moved to talk
+		testRevision{id: 29, title: "Tree", redirect: "Trees"}.xml(3),                  // older than indexed
+		testRevision{id: 40, ns: 1, title: "Talk:Rose", text: "Never indexed."}.xml(4), // never indexed
+	), opts)
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	want := []index.Doc{
+		{Title: "Fern", PageID: 1, RevisionID: 11, SHA1: "sha11", Deleted: true},
+		{Title: "Talk:Moss", PageID: 2, RevisionID: 21, SHA1: fmt.Sprintf("sha21%x", "Moss?"), Deleted: true},
+	}
+	if !slices.Equal(res.removed, want) {
+		t.Errorf("tombstones = %+v, want %+v", res.removed, want)
+	}
+	if len(res.pages) != 0 {
+		t.Errorf("%d pages to index, want none", len(res.pages))
+	}
+
+	// a page already tombstoned isn't again
+	for _, doc := range res.removed {
+		if _, err := docs.Append(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res = processChunk(testChunk(testRevision{id: 12, title: "Fern", redirect: "Ferns"}.xml(1)), opts)
+	if res.err != nil || len(res.removed) != 0 {
+		t.Errorf("tombstones of a removed page = %+v, %v, want none", res.removed, res.err)
+	}
+}
+
+func TestProcessChunkStaleTerms(t *testing.T) {
+	dir := t.TempDir()
+	docs := writeTestTables(t, dir, nil, nil, nil)
+	indexRevisions(t, dir, docs, map[int64]testRevision{
+		1: {id: 10, title: "Fern", text: "A fern grows spores."},
+		2: {id: 20, title: "Moss", text: "Moss grows on rocks."},
+		3: {id: 30, title: "Tree", text: "A tree has bark."},
+	})
+	opts := articleOptions()
+	opts.docs = docs
+	opts.savePath = dir
+	res := processChunk(testChunk(
+		testRevision{id: 11, title: "Fern", text: "A fern is a plant."}.xml(1), // edited since
+		testRevision{id: 21, title: "Moss", redirect: "Mosses"}.xml(2),         // now a redirect
+		testRevision{id: 30, title: "Tree", text: "A tree has bark."}.xml(3),   // already indexed
+		testRevision{id: 40, title: "Rose", text: "A rose has thorns."}.xml(4), // new
+	), opts)
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	// the old revisions' terms, whether or not the new ones have them too
+	exact := res.staleTerms[index.FieldExact]
+	for _, term := range []string{"spores", "rocks", "fern", "moss"} {
+		if !slices.Contains(exact, term) {
+			t.Errorf("stale exact terms %v are missing %q", exact, term)
+		}
+	}
+	for _, term := range []string{"bark", "thorns", "plant"} {
+		if slices.Contains(exact, term) {
+			t.Errorf("stale exact terms %v have %q", exact, term)
+		}
+	}
+	if title := res.staleTerms[index.FieldTitle]; !slices.Contains(title, "moss") {
+		t.Errorf("stale title terms = %v, want moss", title)
+	}
+}
+
+func TestProcessChunkHistory(t *testing.T) {
+	// an incremental dump has every revision made since the last one
+	history := historyXML(1,
+		testRevision{id: 10, title: "Fern", text: "A fern is a plant."},
+		testRevision{id: 12, title: "Fern", text: "A fern has spores."},
+	)
+	res := processChunk(testChunk(history), articleOptions())
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if len(res.pages) != 1 || res.pages[0].doc.RevisionID != 12 || res.pages[0].wordFreqs["spores"] != 1 {
+		t.Fatalf("pages = %+v, want the last revision of Fern", res.pages)
+	}
+	if _, ok := res.pages[0].wordFreqs["plant"]; ok {
+		t.Error("words of an earlier revision were indexed")
+	}
+}
@@ -1,24 +1,27 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"compress/bzip2"
 	"context"
+	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
 	"github.com/samiam2013/wiki4dummies/normalize"
 	"github.com/samiam2013/wiki4dummies/wiki"
 	"github.com/semantosoph/gowiki"
@@ -29,12 +32,37 @@ func init() {
 	gowiki.DebugLevel = 0 // this should absolutely not be a thing
 }
 
+// defaultPageInterval is the minimum time between saving two pages. Pages are
+// saved one at a time, so any interval caps the whole ingest, it's only set to
+// keep the indexer from saturating a slow disk.
+const defaultPageInterval = 0
+
+// defaultFlushPages is how many pages of postings are buffered in memory
+// before being written out as an index segment.
+const defaultFlushPages = 20_000
+
 func main() {
-	var wikiDumpPath, savePath string
-	var resumeLineNum int
+	var wikiDumpPath, multistreamIndexPath, savePath, dbName, namespaceList string
+	var resume, positions, update bool
+	var workers, flushPages int
+	var pageInterval time.Duration
 	flag.StringVar(&wikiDumpPath, "dump_path", "", "Path to the Wikipedia dump file")
+	flag.StringVar(&multistreamIndexPath, "index_path", "",
+		"Path to the dump's multistream-index file, enables parallel decompression")
 	flag.StringVar(&savePath, "save_path", "", "Path to the save index, page files")
-	flag.IntVar(&resumeLineNum, "resume", 0, "Line number to resume from")
+	flag.StringVar(&dbName, "dbname", "enwiki", "Only ingest dumps of the wiki with this dbname, empty for any")
+	flag.StringVar(&namespaceList, "namespaces", "0",
+		"Comma separated keys of the namespaces to index, e.g. 0,14,100 for articles, categories and portals")
+	flag.BoolVar(&resume, "resume", false, "Resume from the checkpoint in save_path")
+	flag.BoolVar(&update, "update", false,
+		"Apply an adds-changes incremental dump to the index in save_path, replacing the pages it has new revisions of")
+	flag.IntVar(&workers, "workers", runtime.NumCPU(), "Number of pages parsing workers")
+	flag.DurationVar(&pageInterval, "page_interval", defaultPageInterval,
+		"Minimum time between saving pages, 0 for no limit")
+	flag.IntVar(&flushPages, "flush_pages", defaultFlushPages,
+		"Number of pages to hold in memory before flushing an index segment")
+	flag.BoolVar(&positions, "positions", false,
+		"Record word positions, needed for phrase and NEAR queries")
 	flag.Parse()
 
 	if wikiDumpPath == "" {
@@ -45,7 +73,15 @@ func main() {
 	}
 	if !strings.HasSuffix(wikiDumpPath, ".xml.bz2") {
 		slog.Error("wikiDumpPath must be an bzip2 compressed XML " +
-			"'pages-articles-multistream' file")
+			"'pages-articles-multistream' or, to update, 'pages-meta-hist-incr' file")
+	}
+	if update && multistreamIndexPath != "" {
+		slog.Error("Incremental dumps aren't multistream, the index_path arg can't be used to update")
+		return
+	}
+	if workers < 1 {
+		slog.Error("The workers arg must be at least 1")
+		return
 	}
 	slog.Info("Starting stream of Wikipedia dump file", "dump_path", wikiDumpPath)
 
@@ -54,219 +90,487 @@ func main() {
 		slog.Error("Failed to open dump file", "error", err)
 	}
 	defer func() { _ = fh.Close() }()
-	xfh := bzip2.NewReader(fh)
-	s := bufio.NewScanner(xfh)
-	// this is an insane size, unsure this is necessary
-	s.Buffer(make([]byte, 0, 64*1024), 100*1024*1024)
-
-	// this section is just to check that it's english wikipedia
-	// siteInfoSection := false
-	// siteInfo := make([]byte, 0, 1024*1024)
-	// for s.Scan() {
-	// 	line := s.Bytes()
-	// 	if bytes.Contains(line, []byte("<siteinfo>")) {
-	// 		siteInfoSection = true
-	// 	}
-	// 	if siteInfoSection {
-	// 		siteInfo = append(siteInfo, append(line, []byte("\n")...)...)
-	// 	}
-	// 	if bytes.Contains(line, []byte("</siteinfo>")) {
-	// 		siteInfoSection = false
-	// 		var si wiki.Siteinfo
-	// 		fmt.Printf("siteInfo:\n%s\n", string(siteInfo))
-	// 		if err := xml.Unmarshal(siteInfo, &si); err != nil {
-	// 			slog.Error("Failed to unmarshal siteinfo", "error", err)
-	// 			return
-	// 		}
-	// 		slog.Info("Parsed siteinfo", "sitename", si.Sitename, "dbname", si.Dbname)
-	// 		if si.Dbname != "enwiki" {
-	// 			slog.Error("Won't parse non-English Wikipedia", "dbname", si.Dbname)
-	// 			return
-	// 		}
-	// 		break
-	// 	}
-	// }
-
-	// TODO make the rate a const
-	limiter := rate.NewLimiter(rate.Every(150*time.Millisecond), 1)
-
-	var lastPageStartLineNum int
-
-	lastLine := func() {
-		slog.Info("Last page start line number (use --resume)", "line_num", lastPageStartLineNum)
-	}
-
-	// open a channel to listen for signals to stop
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-sig
-		slog.Info("Received signal to stop")
-		lastLine()
-		os.Exit(0)
-	}()
-
-	pageSection := false
-	pageBuffer := make([]byte, 0, 10*1024*1024)
-	lineNum := 0
-	for s.Scan() {
-		line := s.Bytes()
-		lineNum++
-		if lineNum < resumeLineNum {
-			continue
+
+	si, err := readDumpSiteinfo(wikiDumpPath)
+	if err != nil {
+		slog.Error("Failed to read siteinfo", "error", err)
+		return
+	}
+	slog.Info("Parsed siteinfo", "sitename", si.Sitename, "dbname", si.Dbname)
+	if dbName != "" && si.Dbname != dbName {
+		slog.Error("Won't parse a dump of another wiki", "dbname", si.Dbname, "want", dbName)
+		return
+	}
+	manifest, err := manifestFromSiteinfo(si)
+	if err != nil {
+		slog.Error("Failed to read siteinfo", "error", err)
+		return
+	}
+	if update {
+		if err := checkUpdate(savePath, wikiDumpPath); err != nil {
+			slog.Error("Can't update index", "error", err)
+			return
+		}
+	}
+	manifest, err = openManifest(savePath, manifest, positions)
+	if err != nil {
+		slog.Error("Failed to open index manifest", "error", err)
+		return
+	}
+	namespaces, err := parseNamespaces(namespaceList, manifest)
+	if err != nil {
+		slog.Error("Failed to parse namespaces arg", "error", err)
+		return
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if pageInterval > 0 {
+		limiter = rate.NewLimiter(rate.Every(pageInterval), 1)
+	}
+
+	dumpFile := filepath.Base(wikiDumpPath)
+	cp := checkpoint{DumpFile: dumpFile, StreamOffset: -1}
+	if resume {
+		cp, err = resumeCheckpoint(savePath, dumpFile)
+		if err != nil {
+			slog.Error("Failed to load checkpoint", "error", err)
+			return
 		}
-		if bytes.Contains(line, []byte("<page>")) {
-			lastPageStartLineNum = lineNum - 1
-			pageSection = true
+		slog.Info("Resuming from checkpoint", "last_page_id", cp.LastPageID,
+			"stream_offset", cp.StreamOffset)
+	}
+
+	// stop between chunks on a signal, so the checkpoint matches what's indexed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var chunks <-chan chunk
+	var scanErr <-chan error
+	if multistreamIndexPath != "" {
+		offsets, err := readMultistreamIndex(multistreamIndexPath)
+		if err != nil {
+			slog.Error("Failed to read multistream index", "error", err)
+			return
 		}
-		if pageSection {
-			pageBuffer = append(pageBuffer, append(line, []byte("\n")...)...)
+		if cp.StreamOffset > 0 {
+			offsets = slices.DeleteFunc(offsets, func(o int64) bool { return o < cp.StreamOffset })
 		}
-		if bytes.Contains(line, []byte("</page>")) {
+		slog.Info("Read multistream index", "streams", len(offsets), "workers", workers)
+		chunks, err = multistreamChunks(ctx, fh, offsets)
+		if err != nil {
+			slog.Error("Failed to start reading streams", "error", err)
+			return
+		}
+	} else {
+		chunks, scanErr = sequentialChunks(ctx, bzip2.NewReader(fh), cp.LastPageID)
+	}
 
-			pageSection = false
-			pageCopy := append([]byte(nil), pageBuffer...)
-			title, abstract, text, err := parsePage(pageBuffer)
-			if err != nil {
-				if !errors.Is(err, ErrNonArticlePage) {
-					slog.Error("Failed to parse page", "error", err)
-				}
-				pageSection = false
-				pageBuffer = make([]byte, 0, 10*1024*1024)
+	docs, err := index.OpenDocTable(filepath.Join(savePath, constants.DocTableFolder))
+	if err != nil {
+		slog.Error("Failed to open doc table", "error", err)
+		return
+	}
+	defer func() { _ = docs.Close() }()
+	if resume {
+		if err := docs.Truncate(cp.NumDocs); err != nil {
+			slog.Error("Failed to roll doc table back to checkpoint", "error", err)
+			return
+		}
+	}
+
+	redirects, err := index.OpenRedirectTable(filepath.Join(savePath, constants.RedirectTableFolder))
+	if err != nil {
+		slog.Error("Failed to open redirect table", "error", err)
+		return
+	}
+	defer func() { _ = redirects.Close() }()
+	if resume {
+		if err := redirects.Truncate(cp.RedirectBytes); err != nil {
+			slog.Error("Failed to roll redirect table back to checkpoint", "error", err)
+			return
+		}
+	}
+
+	// a redirect already recorded isn't recorded again when its page is
+	// ingested again
+	knownRedirects, err := index.LoadRedirects(filepath.Join(savePath, constants.RedirectTableFolder))
+	if err != nil {
+		slog.Error("Failed to load redirects", "error", err)
+		return
+	}
+
+	links, err := index.OpenLinkTable(filepath.Join(savePath, constants.LinkTableFolder))
+	if err != nil {
+		slog.Error("Failed to open link table", "error", err)
+		return
+	}
+	defer func() { _ = links.Close() }()
+	if resume {
+		if err := links.Truncate(cp.LinkBytes); err != nil {
+			slog.Error("Failed to roll link table back to checkpoint", "error", err)
+			return
+		}
+	}
+
+	builder := index.NewBuilder()
+	segmentPath := filepath.Join(savePath, constants.SegmentFileFolder)
+	if resume {
+		if err := index.RemoveSegmentsAfter(segmentPath, cp.Segments); err != nil {
+			slog.Error("Failed to roll segments back to checkpoint", "error", err)
+			return
+		}
+	}
+	// the tables are synced before the segment is renamed into place, and the
+	// checkpoint is only saved once the postings it covers are on disk, so
+	// resuming can roll back whatever came after it
+	flush := func() error {
+		if err := docs.Sync(); err != nil {
+			return fmt.Errorf("failed to sync doc table: %w", err)
+		}
+		if err := redirects.Sync(); err != nil {
+			return fmt.Errorf("failed to sync redirect table: %w", err)
+		}
+		if err := links.Sync(); err != nil {
+			return fmt.Errorf("failed to sync link table: %w", err)
+		}
+		if err := builder.Flush(segmentPath); err != nil {
+			return fmt.Errorf("failed to flush segment: %w", err)
+		}
+		segments, err := index.SegmentCount(segmentPath)
+		if err != nil {
+			return err
+		}
+		cp.NumDocs = docs.Len()
+		cp.RedirectBytes = redirects.Size()
+		cp.LinkBytes = links.Size()
+		cp.Segments = segments
+		if err := saveCheckpoint(savePath, cp); err != nil {
+			return fmt.Errorf("failed to save checkpoint: %w", err)
+		}
+		return nil
+	}
+
+	unchanged := 0
+	commit := func(r chunkResult) error {
+		for _, redirect := range r.redirects {
+			from, to := index.NormalizeTitle(redirect.From), index.NormalizeTitle(redirect.To)
+			if known, ok := knownRedirects[from]; ok && known == to {
 				continue
 			}
-			// slog.Info("Parsed page", "title", title)
-
-			if err := limiter.Wait(context.Background()); err != nil {
-				slog.Error("Failed to wait for limiter", "error", err)
-				lastLine()
-				return
+			if err := redirects.Append(redirect); err != nil {
+				return fmt.Errorf("failed to add redirect: %w", err)
 			}
-
-			// coalesce abstract and text
-			if text == "" {
-				text = abstract
+			knownRedirects[from] = to
+		}
+		unchanged += r.unchanged
+		for _, page := range r.pages {
+			if err := limiter.Wait(context.WithoutCancel(ctx)); err != nil {
+				return fmt.Errorf("failed to wait for limiter: %w", err)
 			}
 
-			relSavedPath, err := savePage(savePath, title, pageCopy)
+			// a changed page gets a new doc, superseding the one it had
+			_, replaced := docs.Lookup(page.doc.PageID)
+			relSavedPath, err := savePage(savePath, page.title, page.raw)
 			if err != nil {
 				slog.Error("Failed to save page", "error", err)
-				pageSection = false
-				pageBuffer = make([]byte, 0, 10*1024*1024)
 				continue
 			}
-			slog.Info("Saved page", "title", title, "relative path", relSavedPath)
+			slog.Info("Saved page", "title", page.title, "relative path", relSavedPath, "replaced", replaced)
+			if page.infobox != nil {
+				if err := saveInfobox(savePath, relSavedPath, page.infobox); err != nil {
+					slog.Error("Failed to save infobox", "title", page.title, "error", err)
+				}
+			}
 
-			if err := indexPage(savePath, relSavedPath, text); err != nil {
-				slog.Error("Failed to index page", "error", err)
+			page.doc.RelPath = relSavedPath
+			docID, err := docs.Append(page.doc)
+			if err != nil {
+				return fmt.Errorf("failed to add doc: %w", err)
+			}
+			if err := links.Append(index.PageLinks{DocID: docID, To: page.links, Categories: page.categories}); err != nil {
+				return fmt.Errorf("failed to add links: %w", err)
+			}
+			builder.Add(docID, page.wordFreqs, page.stemmedWordFreqs, page.positions)
+			builder.AddTitle(docID, page.titleWordFreqs, normalize.StemmedWordFreqs(page.titleWordFreqs))
+			builder.AddInfobox(docID, page.infoboxTerms)
+
+			// a redirect that became an article isn't a redirect anymore
+			if title := index.NormalizeTitle(page.title); knownRedirects[title] != "" {
+				if err := redirects.Append(index.Redirect{From: page.title}); err != nil {
+					return fmt.Errorf("failed to remove redirect: %w", err)
+				}
+				delete(knownRedirects, title)
 			}
+		}
+		for field, terms := range r.staleTerms {
+			builder.Drop(field, terms)
+		}
+		for _, tombstone := range r.removed {
+			if _, err := docs.Append(tombstone); err != nil {
+				return fmt.Errorf("failed to remove doc: %w", err)
+			}
+			slog.Info("Removed page", "title", tombstone.Title)
+		}
+		cp.LastPageID = max(cp.LastPageID, r.lastPageID)
+		cp.StreamOffset = r.chunk.nextOffset
+		if builder.Pages() < flushPages {
+			return nil
+		}
+		return flush()
+	}
+	ingestErr := ingest(ctx, chunks, workers, parseOptions{
+		positions:  positions,
+		manifest:   manifest,
+		namespaces: namespaces,
+		docs:       docs,
+		savePath:   savePath,
+	}, commit)
+	// flush whatever was committed, even when stopping early, so it's covered
+	// by the checkpoint
+	if err := flush(); err != nil {
+		slog.Error("Failed to flush index", "error", err)
+		return
+	}
+	if ingestErr != nil {
+		if errors.Is(ingestErr, context.Canceled) {
+			slog.Info("Stopped, use --resume to continue", "last_page_id", cp.LastPageID)
+			return
+		}
+		slog.Error("Failed to ingest dump", "error", ingestErr)
+		return
+	}
+	if scanErr != nil {
+		if err := <-scanErr; err != nil {
+			slog.Error("Failed to scan dump file", "error", err)
+			return
+		}
+	}
+
+	// aliases can only be indexed once every redirect target is in the doc
+	// table
+	if !cp.AliasesIndexed {
+		slog.Info("Indexing redirects as aliases")
+		n, err := indexAliases(savePath, docs, builder)
+		if err != nil {
+			slog.Error("Failed to index aliases", "error", err)
+			return
+		}
+		cp.AliasesIndexed = true
+		if err := flush(); err != nil {
+			slog.Error("Failed to flush aliases", "error", err)
+			return
+		}
+		slog.Info("Indexed aliases", "redirects", n)
+	}
 
-			pageBuffer = make([]byte, 0, 10*1024*1024)
+	// backlinks resolve through redirects, so need every one of them
+	if !cp.BacklinksIndexed {
+		slog.Info("Indexing backlinks")
+		n, err := indexBacklinks(savePath, docs)
+		if err != nil {
+			slog.Error("Failed to index backlinks", "error", err)
+			return
 		}
+		cp.BacklinksIndexed = true
+		if err := saveCheckpoint(savePath, cp); err != nil {
+			slog.Error("Failed to save checkpoint", "error", err)
+			return
+		}
+		slog.Info("Indexed backlinks", "linked_pages", n)
 	}
-	if err := s.Err(); err != nil {
-		slog.Error("Failed to scan dump file", "error", err)
+	if !cp.CategoriesIndexed {
+		slog.Info("Indexing categories")
+		n, err := indexCategories(savePath, docs)
+		if err != nil {
+			slog.Error("Failed to index categories", "error", err)
+			return
+		}
+		cp.CategoriesIndexed = true
+		if err := saveCheckpoint(savePath, cp); err != nil {
+			slog.Error("Failed to save checkpoint", "error", err)
+			return
+		}
+		slog.Info("Indexed categories", "categories", n)
 	}
 
+	slog.Info("Merging index segments")
+	if err := index.Merge(segmentPath, filepath.Join(savePath, constants.IndexFileFolder), docs.Superseded); err != nil {
+		slog.Error("Failed to merge index segments", "error", err)
+		return
+	}
+	if err := recordDumpDate(savePath, manifest, wikiDumpPath); err != nil {
+		slog.Error("Failed to record dump in manifest", "error", err)
+		return
+	}
+	slog.Info("Finished indexing dump", "last_page_id", cp.LastPageID, "unchanged_pages", unchanged)
 }
 
+func readMultistreamIndex(indexPath string) ([]int64, error) {
+	fh, err := os.Open(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open multistream index: %w", err)
+	}
+	defer func() { _ = fh.Close() }()
+	var r io.Reader = fh
+	if strings.HasSuffix(indexPath, ".bz2") {
+		r = bzip2.NewReader(fh)
+	}
+	return wiki.ReadMultistreamIndex(r)
+}
+
+// ErrNonArticlePage is returned for pages that aren't indexed, those outside
+// the namespaces being indexed and redirects.
 var ErrNonArticlePage = fmt.Errorf("skipping non-article page")
 
-// parsePage returns title, abstract, text, error and only contains the text if
-// it was not able to parse the abstract
-func parsePage(pageBuffer []byte) (string, string, string, error) {
+// ErrRedirectPage is returned along with the page for redirects, which are
+// recorded as aliases of their targets instead of being indexed.
+var ErrRedirectPage = fmt.Errorf("%w: redirect", ErrNonArticlePage)
+
+// ErrUnchangedPage is returned for pages whose revision, or a later one, is
+// already indexed, which are skipped.
+var ErrUnchangedPage = errors.New("page is already indexed")
+
+// article is what's kept of a page's parsed wikitext.
+type article struct {
+	abstract string
+	text     string
+	// links are the titles of the articles linked to, each once
+	links      []string
+	categories []string
+}
+
+// parsePage returns the page and its parsed article
+func parsePage(pageBuffer []byte, opts parseOptions) (wiki.Page, article, error) {
 	var page wiki.Page
 	if err := xml.Unmarshal(pageBuffer, &page); err != nil {
-		return "", "", "", fmt.Errorf("failed to unmarshal page: %w", err)
+		return wiki.Page{}, article{}, fmt.Errorf("failed to unmarshal page: %w", err)
 	}
 
-	if page.Ns != "0" {
-		return "", "", "", fmt.Errorf("non-article page: %w type %s title %s",
-			ErrNonArticlePage, page.Ns, page.Title)
+	ns, ok := opts.manifest.Namespace(page.Ns)
+	if !ok {
+		return wiki.Page{}, article{}, fmt.Errorf("unknown namespace %s of page %s", page.Ns, page.Title)
+	}
+	if _, ok := opts.namespaces[ns.Key]; !ok {
+		return page, article{}, fmt.Errorf("non-article page: %w type %s title %s",
+			ErrNonArticlePage, ns.Name, page.Title)
 	}
 	if page.Redirect.Title != "" {
-		return "", "", "", fmt.Errorf("redirect page: %w title %s", ErrNonArticlePage, page.Title)
+		return page, article{}, fmt.Errorf("redirect page: %w title %s", ErrRedirectPage, page.Title)
+	}
+	if opts.docs != nil {
+		indexed, err := indexedRevision(opts.docs, page)
+		if err != nil {
+			return wiki.Page{}, article{}, err
+		}
+		if indexed {
+			return page, article{}, fmt.Errorf("%w: title %s", ErrUnchangedPage, page.Title)
+		}
 	}
 
-	article, err := gowiki.ParseArticle(page.Title, page.Revision.Text.Text, &gowiki.DummyPageGetter{})
+	parsed, err := gowiki.ParseArticle(page.Title, page.Revision.Text.Text, &gowiki.DummyPageGetter{})
 	if err != nil {
-		return "", "", "", fmt.Errorf("failed to parse article: %w", err)
+		return wiki.Page{}, article{}, fmt.Errorf("failed to parse article: %w", err)
 	}
 
-	abstract := article.GetAbstract()
+	abstract := parsed.GetAbstract()
 	abstract = strings.ReplaceAll(abstract, "\n", "")
-	pageText := article.GetText()
-
-	return page.Title, abstract, pageText, nil
+	return page, article{
+		abstract:   abstract,
+		text:       parsed.GetText(),
+		links:      articleLinks(parsed.GetLinks()),
+		categories: articleCategories(parsed.GetLinks()),
+	}, nil
 }
 
-func indexPage(savePath, relSavedPath, text string) error {
-	// build the word frequency
-	wordFreqs, err := wiki.GatherWordFrequency(strings.NewReader(text))
+// indexedRevision reports whether the page's latest doc is of the same
+// revision or a later one, so ingesting an older dump never goes back.
+func indexedRevision(docs *index.DocTable, page wiki.Page) (bool, error) {
+	pageID, err := strconv.ParseInt(page.ID, 10, 64)
 	if err != nil {
-		return fmt.Errorf("failed to gather word frequency: %w", err)
+		return false, fmt.Errorf("failed to parse page id of %s: %w", page.Title, err)
 	}
-	// build a copy of the word frequency but stemmed
-	stemmedWordFreqs := normalize.StemmedWordFreqs(wordFreqs)
-
-	// build the path for the index
-	indexPath := filepath.Join(savePath, constants.IndexFileFolder)
-	// add the exact word match freqs to the indexes
-	for word, freq := range wordFreqs {
-		triePath, err := normalize.TrieMake(indexPath, word)
-		if err != nil {
-			return fmt.Errorf("failed to make trie path: %w", err)
-		}
-		idxSavePath := filepath.Join(triePath, word+".idx")
-		if err := addToIndex(idxSavePath, freq, true, relSavedPath); err != nil {
-			return fmt.Errorf("failed to add to index: %w", err)
-		}
+	docID, ok := docs.Lookup(pageID)
+	if !ok {
+		return false, nil
 	}
-
-	// add the stemmed word match freqs to the indexes
-	for word, freq := range stemmedWordFreqs {
-		triePath, err := normalize.TrieMake(indexPath, word)
-		if err != nil {
-			return fmt.Errorf("failed to make trie path: %w", err)
-		}
-		idxSavePath := filepath.Join(triePath, word+".idx")
-		if err := addToIndex(idxSavePath, freq, false, relSavedPath); err != nil {
-			return fmt.Errorf("failed to add to index: %w", err)
-		}
+	doc, err := docs.Get(docID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get doc: %w", err)
 	}
-	return nil
+	revisionID, _ := strconv.ParseInt(page.Revision.ID, 10, 64)
+	if doc.RevisionID > revisionID {
+		return true, nil
+	}
+	return doc.SameRevision(index.Doc{
+		PageID:     pageID,
+		RevisionID: revisionID,
+		SHA1:       page.Revision.Sha1,
+		Title:      page.Title,
+	}), nil
 }
 
-func addToIndex(indexPath string, freq int, exact bool, relSavedPath string) error {
-	// if the file does not exist, create it
-	fh, err := os.OpenFile(indexPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// removedPage returns a tombstone for the page's latest doc when the page
+// isn't indexed anymore, because it became a redirect or moved out of the
+// indexed namespaces. Like indexedRevision, an older revision changes nothing.
+func removedPage(docs *index.DocTable, page wiki.Page) (index.Doc, bool, error) {
+	pageID, err := strconv.ParseInt(page.ID, 10, 64)
 	if err != nil {
-		return fmt.Errorf("failed to open index file: %w", err)
+		return index.Doc{}, false, fmt.Errorf("failed to parse page id of %s: %w", page.Title, err)
 	}
-	defer func() { _ = fh.Close() }()
-
-	line := fmt.Sprintf("%d,%t,%s\n", freq, exact, relSavedPath)
-	// always seek to the end of the file first, can't hurt, necessary often
-	if _, err := fh.Seek(0, 2); err != nil {
-		return fmt.Errorf("failed to seek to end of file: %w", err)
+	docID, ok := docs.Lookup(pageID)
+	if !ok {
+		return index.Doc{}, false, nil
+	}
+	doc, err := docs.Get(docID)
+	if err != nil {
+		return index.Doc{}, false, fmt.Errorf("failed to get doc: %w", err)
 	}
-	// write the line
-	if _, err := fh.WriteString(line); err != nil {
-		return fmt.Errorf("failed to write to file: %w", err)
+	revisionID, _ := strconv.ParseInt(page.Revision.ID, 10, 64)
+	if doc.Deleted || doc.RevisionID > revisionID {
+		return index.Doc{}, false, nil
 	}
-	// slog.Info("Added to index", "index_path", indexPath, "line", line)
+	return index.Doc{
+		Title:      page.Title,
+		PageID:     pageID,
+		RevisionID: revisionID,
+		SHA1:       page.Revision.Sha1,
+		Deleted:    true,
+	}, true, nil
+}
 
-	return nil
+// articleLinks keeps the links to other articles, dropping those to other
+// namespaces and section links within the page.
+func articleLinks(links []gowiki.WikiLink) []string {
+	seen := make(map[string]struct{}, len(links))
+	titles := make([]string, 0, len(links))
+	for _, l := range links {
+		// a leading colon links to a namespace page instead of including it
+		if l.Namespace != "" || l.PageName == "" || strings.HasPrefix(l.PageName, ":") {
+			continue
+		}
+		if _, ok := seen[l.PageName]; ok {
+			continue
+		}
+		seen[l.PageName] = struct{}{}
+		titles = append(titles, l.PageName)
+	}
+	return titles
 }
 
-var nonAlphaNum = regexp.MustCompile("[^a-zA-Z0-9]+")
+// articleCategories is the names of the categories the article is in, each
+// once.
+func articleCategories(links []gowiki.WikiLink) []string {
+	var categories []string
+	for _, l := range links {
+		if l.Namespace == "Category" && l.PageName != "" && !slices.Contains(categories, l.PageName) {
+			categories = append(categories, l.PageName)
+		}
+	}
+	return categories
+}
 
 func savePage(savePath, title string, pageBuffer []byte) (string, error) {
-	// slug-ify the title:
-	// 1. lowercase 2. replace spaces with dashe 3. remove leading and trailing dashes
-	title = strings.ToLower(title)
-	title = nonAlphaNum.ReplaceAllString(title, "-")
-	title = strings.Trim(title, "-")
+	title = normalize.Slug(title)
 
 	folderPath, err := normalize.TrieMake(filepath.Join(savePath, constants.PageFileFolder), title)
 	if err != nil {
@@ -287,3 +591,17 @@ func savePage(savePath, title string, pageBuffer []byte) (string, error) {
 	relPath := strings.TrimPrefix(filePath, leadPath)
 	return relPath, nil
 }
+
+// saveInfobox writes the infobox as JSON beside the page saved at relPath.
+func saveInfobox(savePath, relPath string, ib *wiki.Infobox) error {
+	b, err := json.Marshal(ib)
+	if err != nil {
+		return fmt.Errorf("failed to marshal infobox: %w", err)
+	}
+	infoboxPath := filepath.Join(savePath, constants.PageFileFolder,
+		strings.TrimSuffix(relPath, ".xml")+constants.InfoboxFileSuffix)
+	if err := os.WriteFile(infoboxPath, b, 0644); err != nil {
+		return fmt.Errorf("failed to write infobox: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"compress/bzip2"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/wiki"
+)
+
+// testdata/multistream.xml.bz2 is a dump of three streams: the siteinfo, the
+// pages with IDs 1 to 3 and the page with ID 4. Page 2 is a talk page and
+// page 3 a redirect.
+const (
+	testDump      = "testdata/multistream.xml.bz2"
+	testDumpIndex = "testdata/multistream-index.txt"
+)
+
+// chunkPageIDs loads every chunk, returning the IDs of the pages in each and
+// where the stream after each starts.
+func chunkPageIDs(t *testing.T, chunks <-chan chunk) ([][]int64, []int64) {
+	t.Helper()
+	var pageIDs [][]int64
+	var nextOffsets []int64
+	for c := range chunks {
+		pages, err := c.load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]int64, 0, len(pages))
+		for _, page := range pages {
+			id, err := wiki.PageID(page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		pageIDs = append(pageIDs, ids)
+		nextOffsets = append(nextOffsets, c.nextOffset)
+	}
+	return pageIDs, nextOffsets
+}
+
+func openTestDump(t *testing.T) *os.File {
+	t.Helper()
+	fh, err := os.Open(testDump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = fh.Close() })
+	return fh
+}
+
+func TestMultistreamChunks(t *testing.T) {
+	offsets, err := readMultistreamIndex(testDumpIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{312, 638}; !slices.Equal(offsets, want) {
+		t.Fatalf("offsets = %v, want %v", offsets, want)
+	}
+	fh := openTestDump(t)
+	chunks, err := multistreamChunks(context.Background(), fh, offsets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageIDs, nextOffsets := chunkPageIDs(t, chunks)
+	if len(pageIDs) != 2 || !slices.Equal(pageIDs[0], []int64{1, 2, 3}) || !slices.Equal(pageIDs[1], []int64{4}) {
+		t.Errorf("chunk page IDs = %v, want [[1 2 3] [4]]", pageIDs)
+	}
+	// the last stream runs to the end of the file
+	if want := []int64{638, 884}; !slices.Equal(nextOffsets, want) {
+		t.Errorf("next offsets = %v, want %v", nextOffsets, want)
+	}
+
+	si, err := readDumpSiteinfo(testDump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si.Dbname != "testwiki" {
+		t.Errorf("siteinfo of the first stream = %+v", si)
+	}
+}
+
+func TestSequentialChunks(t *testing.T) {
+	chunks, errc := sequentialChunks(context.Background(), bzip2.NewReader(openTestDump(t)), 1)
+	pageIDs, nextOffsets := chunkPageIDs(t, chunks)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	// pages up to the one resumed after are skipped
+	if len(pageIDs) != 1 || !slices.Equal(pageIDs[0], []int64{2, 3, 4}) || nextOffsets[0] != -1 {
+		t.Errorf("chunk page IDs = %v, next offsets %v, want [[2 3 4]] and no offset", pageIDs, nextOffsets)
+	}
+
+	var dump strings.Builder
+	for id := range int64(2*pagesPerChunk + 5) {
+		dump.Write(testRevision{id: 10 * (id + 1), title: fmt.Sprint("Page ", id+1), text: "Text."}.xml(id + 1))
+	}
+	chunks, errc = sequentialChunks(context.Background(), strings.NewReader(dump.String()), 0)
+	pageIDs, _ = chunkPageIDs(t, chunks)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if len(pageIDs) != 3 || len(pageIDs[0]) != pagesPerChunk || len(pageIDs[2]) != 5 || pageIDs[2][4] != 2*pagesPerChunk+5 {
+		t.Errorf("%d chunks of %d pages", len(pageIDs), len(pageIDs[0]))
+	}
+}
+
+func TestIngest(t *testing.T) {
+	offsets, err := readMultistreamIndex(testDumpIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := multistreamChunks(context.Background(), openTestDump(t), offsets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []chunkResult
+	err = ingest(context.Background(), chunks, 3, articleOptions(), func(r chunkResult) error {
+		results = append(results, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// committed in the order of the dump, the talk page left out
+	if len(results) != 2 {
+		t.Fatalf("%d chunks committed, want 2", len(results))
+	}
+	first, second := results[0], results[1]
+	if first.chunk.nextOffset != 638 || first.lastPageID != 3 || len(first.pages) != 1 || first.pages[0].title != "Fern" ||
+		!slices.Equal(first.redirects, []index.Redirect{{From: "Ferns", To: "Fern"}}) {
+		t.Errorf("first chunk = %+v", first)
+	}
+	if second.lastPageID != 4 || len(second.pages) != 1 || second.pages[0].title != "Plant" ||
+		!slices.Equal(second.pages[0].links, []string{"Fern"}) {
+		t.Errorf("second chunk = %+v", second)
+	}
+
+	// a chunk that fails to load stops the ingest
+	failing := make(chan chunk, 2)
+	failing <- chunk{load: func() ([][]byte, error) { return nil, errors.New("corrupt stream") }}
+	failing <- chunk{load: func() ([][]byte, error) { return nil, nil }}
+	close(failing)
+	committed := 0
+	err = ingest(context.Background(), failing, 2, articleOptions(), func(chunkResult) error {
+		committed++
+		return nil
+	})
+	if err == nil || committed != 0 {
+		t.Errorf("ingest of a corrupt stream = %v after %d commits", err, committed)
+	}
+}
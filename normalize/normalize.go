@@ -5,16 +5,35 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime/debug"
 	"strings"
 
 	"github.com/caneroj1/stemmer"
 )
 
+// TokenizerVersion is bumped whenever SplitAndLower or Stem change the words
+// text is indexed under.
+const TokenizerVersion = 2
+
+// SlugVersion is bumped whenever Slug or InfoboxKey change the names titles
+// and infobox fields are saved under.
+const SlugVersion = 1
+
+// TrieDepth is how many of a title's characters TriePath nests it under.
+const TrieDepth = 2
+
+// MaxWordLen is the longest word indexed. Longer runs of letters, like DNA
+// sequences, are left out, they'd make file names too long to create.
+const MaxWordLen = 100
+
 var _reGetLowerWords = regexp.MustCompile(`[a-zA-Z]+`)
 
 func SplitAndLower(s string) []string {
 	words := make([]string, 0)
 	for _, match := range _reGetLowerWords.FindAllString(s, -1) {
+		if len(match) > MaxWordLen {
+			continue
+		}
 		words = append(words, strings.ToLower(match))
 	}
 	return words
@@ -25,25 +44,78 @@ func SplitAndLower(s string) []string {
 func StemmedWordFreqs(wordFreqs map[string]int) map[string]int {
 	stemmedWordFreqs := make(map[string]int)
 	for word, freq := range wordFreqs {
-		stem := stemmer.Stem(word)
-		stem = strings.ToLower(stem)
-		stemmedWordFreqs[stem] += freq
+		stemmedWordFreqs[Stem(word)] += freq
 	}
 	return stemmedWordFreqs
 }
 
-// TrieMake creates a directory structure for the title with the first two characters
-func TrieMake(savePath, title string) (string, error) {
-	if len(title) < 3 {
-		title = fmt.Sprintf("%3s", title)
-		title = strings.ReplaceAll(title, " ", "_")
+// Stem returns the lowercased stem of a word, the same one the stemmed
+// postings were indexed under.
+func Stem(word string) string {
+	return strings.ToLower(stemmer.Stem(word))
+}
+
+const stemmerModule = "github.com/caneroj1/stemmer"
+
+// Stemmer names the module Stem uses, with its version when the binary was
+// built with module info, like github.com/caneroj1/stemmer@v0.0.0-2017...
+func Stemmer() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return stemmerModule
 	}
-	// create the path
-	first := string(title[0]) // this might break on emoji
-	second := string(title[1])
-	path := filepath.Join(savePath, first, second)
+	for _, dep := range bi.Deps {
+		if dep.Path != stemmerModule {
+			continue
+		}
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		if dep.Version == "" {
+			return stemmerModule
+		}
+		return stemmerModule + "@" + dep.Version
+	}
+	return stemmerModule
+}
+
+var nonAlphaNum = regexp.MustCompile("[^a-zA-Z0-9]+")
+
+// Slug turns a title into the name its page file is saved under: lowercased,
+// with runs of anything but letters and digits replaced by a dash and no
+// leading or trailing dashes.
+func Slug(title string) string {
+	slug := strings.ToLower(title)
+	slug = nonAlphaNum.ReplaceAllString(slug, "-")
+	return strings.Trim(slug, "-")
+}
+
+// InfoboxKey is the name an infobox field is searched by: lowercased, with
+// runs of anything but letters and digits replaced by an underscore, so
+// "Birth place" and "birth_place" are the same field.
+func InfoboxKey(name string) string {
+	return strings.ReplaceAll(Slug(name), "-", "_")
+}
+
+// TrieMake creates a directory structure for the title with its first
+// TrieDepth characters
+func TrieMake(savePath, title string) (string, error) {
+	path := TriePath(savePath, title)
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return "", fmt.Errorf("failed to create parent directories: %w", err)
 	}
 	return path, nil
 }
+
+// TriePath is the directory TrieMake would create for the title.
+func TriePath(savePath, title string) string {
+	if len(title) <= TrieDepth {
+		title = fmt.Sprintf("%*s", TrieDepth+1, title)
+		title = strings.ReplaceAll(title, " ", "_")
+	}
+	parts := []string{savePath}
+	for i := range TrieDepth {
+		parts = append(parts, string(title[i])) // this might break on emoji
+	}
+	return filepath.Join(parts...)
+}
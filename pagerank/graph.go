@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/normalize"
+)
+
+// graph is the links between docs in compressed sparse row form, the docs
+// linked to by doc i are targets[offsets[i]:offsets[i+1]].
+type graph struct {
+	offsets []uint64
+	targets []uint32
+}
+
+func (g *graph) numDocs() int {
+	return len(g.offsets) - 1
+}
+
+func (g *graph) outLinks(docID uint32) []uint32 {
+	return g.targets[g.offsets[docID]:g.offsets[docID+1]]
+}
+
+// loadGraph builds the link graph of the indexed docs from the link table,
+// following links to redirects through to their targets. Links to pages that
+// weren't indexed, links of superseded docs and links from a page to itself
+// are dropped, as are repeated links between the same two docs.
+func loadGraph(savePath string, docs *index.DocTable) (*graph, error) {
+	redirects, err := index.LoadRedirects(filepath.Join(savePath, constants.RedirectTableFolder))
+	if err != nil {
+		return nil, err
+	}
+	numDocs := docs.Len()
+	slugDocs := make(map[string]uint32, numDocs)
+	for docID := range uint32(numDocs) {
+		doc, err := docs.Get(docID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get doc: %w", err)
+		}
+		if !docs.Superseded(docID) {
+			slugDocs[normalize.Slug(doc.Title)] = docID
+		}
+	}
+
+	outLinks := make([][]uint32, numDocs)
+	err = index.ReadLinks(filepath.Join(savePath, constants.LinkTableFolder), func(l index.PageLinks) error {
+		if int(l.DocID) >= numDocs || docs.Superseded(l.DocID) {
+			return nil
+		}
+		targets := make([]uint32, 0, len(l.To))
+		for _, to := range l.To {
+			target, ok := slugDocs[normalize.Slug(index.ResolveRedirect(redirects, to))]
+			if ok && target != l.DocID {
+				targets = append(targets, target)
+			}
+		}
+		slices.Sort(targets)
+		outLinks[l.DocID] = slices.Compact(targets)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g := &graph{offsets: make([]uint64, 1, numDocs+1)}
+	for _, targets := range outLinks {
+		g.targets = append(g.targets, targets...)
+		g.offsets = append(g.offsets, uint64(len(g.targets)))
+	}
+	return g, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+)
+
+func TestLoadGraph(t *testing.T) {
+	savePath := t.TempDir()
+	docs, err := index.OpenDocTable(filepath.Join(savePath, constants.DocTableFolder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = docs.Close() })
+	for _, doc := range []index.Doc{
+		{Title: "Plant", PageID: 1, RevisionID: 10},
+		{Title: "Leaf", PageID: 2, RevisionID: 20},
+		{Title: "Tree", PageID: 3, RevisionID: 30},
+		{Title: "Leaf", PageID: 2, RevisionID: 21}, // supersedes doc 1
+	} {
+		if _, err := docs.Append(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links, err := index.OpenLinkTable(filepath.Join(savePath, constants.LinkTableFolder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []index.PageLinks{
+		{DocID: 0, To: []string{"leaf", "Plant", "Flora", "Green plants", "Moss"}},
+		{DocID: 1, To: []string{"Tree"}},
+		{DocID: 2, To: []string{"Leaf", "leaf"}},
+		{DocID: 3, To: []string{"Tree", "Plant"}},
+	} {
+		if err := links.Append(l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := links.Close(); err != nil {
+		t.Fatal(err)
+	}
+	redirects, err := index.OpenRedirectTable(filepath.Join(savePath, constants.RedirectTableFolder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []index.Redirect{
+		{From: "Flora", To: "Green plants"},
+		{From: "Green plants", To: "Tree"},
+	} {
+		if err := redirects.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := redirects.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := loadGraph(savePath, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.numDocs() != 4 {
+		t.Fatalf("graph has %d docs, want 4", g.numDocs())
+	}
+	want := [][]uint32{
+		{2, 3}, // the self-link, the unindexed Moss and repeats through redirects dropped
+		nil,    // superseded
+		{3},
+		{0, 2},
+	}
+	for docID, w := range want {
+		if got := g.outLinks(uint32(docID)); !slices.Equal(got, w) {
+			t.Errorf("doc %d links to %v, want %v", docID, got, w)
+		}
+	}
+}
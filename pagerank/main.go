@@ -0,0 +1,72 @@
+// The pagerank command computes the PageRank of every indexed doc from the
+// links recorded while ingesting and saves it as the per-doc prior the search
+// server blends into scores. It has to be run again after re-indexing.
+package main
+
+import (
+	"cmp"
+	"flag"
+	"log/slog"
+	"path/filepath"
+	"slices"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+)
+
+func main() {
+	var savePath string
+	var damping, tolerance float64
+	var maxIterations, top int
+	flag.StringVar(&savePath, "save_path", "", "Path to the save index, page files")
+	flag.Float64Var(&damping, "damping", 0.85, "Probability of following a link rather than jumping to a random page")
+	flag.Float64Var(&tolerance, "tolerance", 1e-6, "Stop once the ranks change by less than this in total")
+	flag.IntVar(&maxIterations, "iterations", 100, "Maximum number of iterations")
+	flag.IntVar(&top, "top", 10, "Number of highest ranked pages to log")
+	flag.Parse()
+
+	if savePath == "" {
+		slog.Error("The save_path arg is required")
+		return
+	}
+	if damping <= 0 || damping >= 1 {
+		slog.Error("The damping arg must be between 0 and 1")
+		return
+	}
+
+	docs, err := index.OpenDocTableReadOnly(filepath.Join(savePath, constants.DocTableFolder))
+	if err != nil {
+		slog.Error("Failed to open doc table", "error", err)
+		return
+	}
+	defer func() { _ = docs.Close() }()
+
+	slog.Info("Loading link graph")
+	g, err := loadGraph(savePath, docs)
+	if err != nil {
+		slog.Error("Failed to load link graph", "error", err)
+		return
+	}
+	slog.Info("Loaded link graph", "docs", g.numDocs(), "links", len(g.targets))
+
+	ranks, iterations := pageRank(g, damping, tolerance, maxIterations)
+	slog.Info("Computed PageRank", "iterations", iterations)
+	if err := index.WritePriors(filepath.Join(savePath, constants.PriorFolder), priors(ranks)); err != nil {
+		slog.Error("Failed to save priors", "error", err)
+		return
+	}
+
+	docIDs := make([]uint32, len(ranks))
+	for i := range docIDs {
+		docIDs[i] = uint32(i)
+	}
+	slices.SortFunc(docIDs, func(a, b uint32) int { return cmp.Compare(ranks[b], ranks[a]) })
+	for _, docID := range docIDs[:min(top, len(docIDs))] {
+		doc, err := docs.Get(docID)
+		if err != nil {
+			slog.Error("Failed to get doc", "error", err)
+			return
+		}
+		slog.Info("Top page", "title", doc.Title, "rank", ranks[docID])
+	}
+}
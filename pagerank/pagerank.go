@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+)
+
+// pageRank runs the power iteration until the ranks change by less than
+// tolerance in total or maxIterations is reached. The rank of docs without
+// links out is spread over every doc, as if they linked to all of them. It
+// returns the ranks, which sum to 1, and the iterations run.
+func pageRank(g *graph, damping, tolerance float64, maxIterations int) ([]float64, int) {
+	n := g.numDocs()
+	if n == 0 {
+		return nil, 0
+	}
+	ranks := make([]float64, n)
+	next := make([]float64, n)
+	for i := range ranks {
+		ranks[i] = 1 / float64(n)
+	}
+	iterations := 0
+	for iterations < maxIterations {
+		iterations++
+		var dangling float64
+		for i := range next {
+			next[i] = 0
+		}
+		for docID := range uint32(n) {
+			out := g.outLinks(docID)
+			if len(out) == 0 {
+				dangling += ranks[docID]
+				continue
+			}
+			share := ranks[docID] / float64(len(out))
+			for _, target := range out {
+				next[target] += share
+			}
+		}
+		base := (1-damping)/float64(n) + damping*dangling/float64(n)
+		var delta float64
+		for i := range next {
+			next[i] = base + damping*next[i]
+			delta += math.Abs(next[i] - ranks[i])
+		}
+		ranks, next = next, ranks
+		if delta < tolerance {
+			break
+		}
+	}
+	return ranks, iterations
+}
+
+// priors scales the ranks to between 0 and 1 for blending into search
+// scores. Ranks are spread over orders of magnitude so they're compared on a
+// log scale, a doc with the average rank of 1/n gets log(2)/log(1+n*max).
+func priors(ranks []float64) []float32 {
+	n := float64(len(ranks))
+	var maxScaled float64
+	scaled := make([]float64, len(ranks))
+	for i, r := range ranks {
+		scaled[i] = math.Log1p(n * r)
+		maxScaled = max(maxScaled, scaled[i])
+	}
+	out := make([]float32, len(ranks))
+	if maxScaled == 0 {
+		return out
+	}
+	for i, s := range scaled {
+		out[i] = float32(s / maxScaled)
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// newGraph builds a graph from each doc's outbound links.
+func newGraph(links [][]uint32) *graph {
+	g := &graph{offsets: []uint64{0}}
+	for _, out := range links {
+		g.targets = append(g.targets, out...)
+		g.offsets = append(g.offsets, uint64(len(g.targets)))
+	}
+	return g
+}
+
+func sum(ranks []float64) float64 {
+	var s float64
+	for _, r := range ranks {
+		s += r
+	}
+	return s
+}
+
+func TestPageRank(t *testing.T) {
+	tests := []struct {
+		name  string
+		links [][]uint32
+		check func(t *testing.T, ranks []float64)
+	}{
+		{"cycle ranks every doc the same", [][]uint32{{1}, {2}, {0}}, func(t *testing.T, ranks []float64) {
+			for _, r := range ranks {
+				if math.Abs(r-1.0/3) > 1e-6 {
+					t.Errorf("ranks = %v, want a third each", ranks)
+				}
+			}
+		}},
+		{"hub linked to by every doc ranks highest", [][]uint32{{1}, {0}, {0}, {0}, {0}}, func(t *testing.T, ranks []float64) {
+			for i, r := range ranks[1:] {
+				if r >= ranks[0] {
+					t.Errorf("doc %d rank %f, not below the hub's %f", i+1, r, ranks[0])
+				}
+			}
+			if ranks[1] <= ranks[2] {
+				t.Errorf("doc the hub links to has rank %f, no more than %f", ranks[1], ranks[2])
+			}
+		}},
+		{"dangling docs spread their rank", [][]uint32{{1}, {}, {1}}, func(t *testing.T, ranks []float64) {
+			if ranks[1] <= ranks[0] || ranks[0] != ranks[2] {
+				t.Errorf("ranks = %v, want doc 1 highest and the others equal", ranks)
+			}
+		}},
+		{"no links at all", [][]uint32{{}, {}}, func(t *testing.T, ranks []float64) {
+			if ranks[0] != 0.5 || ranks[1] != 0.5 {
+				t.Errorf("ranks = %v, want a half each", ranks)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranks, iterations := pageRank(newGraph(tt.links), 0.85, 1e-9, 200)
+			if iterations >= 200 {
+				t.Errorf("didn't converge in %d iterations", iterations)
+			}
+			if math.Abs(sum(ranks)-1) > 1e-9 {
+				t.Errorf("ranks sum to %f, want 1", sum(ranks))
+			}
+			tt.check(t, ranks)
+		})
+	}
+
+	if ranks, iterations := pageRank(newGraph(nil), 0.85, 1e-9, 200); ranks != nil || iterations != 0 {
+		t.Errorf("empty graph ranks = %v after %d iterations", ranks, iterations)
+	}
+	if _, iterations := pageRank(newGraph([][]uint32{{1}, {0, 2}, {0}}), 0.85, 0, 7); iterations != 7 {
+		t.Errorf("ran %d iterations, want the maximum 7", iterations)
+	}
+}
+
+func TestPriors(t *testing.T) {
+	ranks := []float64{0.5, 0.25, 0.125, 0.125}
+	got := priors(ranks)
+	if got[0] != 1 {
+		t.Errorf("highest prior = %f, want 1", got[0])
+	}
+	if !slices.IsSortedFunc(got, func(a, b float32) int { return int(math.Copysign(1, float64(b-a))) }) ||
+		got[2] != got[3] || got[3] <= 0 {
+		t.Errorf("priors = %v, want them ordered like the ranks and above 0", got)
+	}
+	if got := priors([]float64{0, 0}); got[0] != 0 || got[1] != 0 {
+		t.Errorf("priors of zero ranks = %v, want 0", got)
+	}
+}
@@ -0,0 +1,256 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Node is part of a parsed query.
+type Node interface {
+	node()
+}
+
+// Term matches pages containing the word.
+type Term struct {
+	Word string
+}
+
+// Phrase matches pages with every word in order, stopwords included.
+type Phrase struct {
+	Words []string
+}
+
+// Near requires two words within Distance words of each other, in either
+// order.
+type Near struct {
+	Left, Right string
+	Distance    int
+}
+
+// InTitle matches pages with every word in their title.
+type InTitle struct {
+	Words []string
+}
+
+// InCategory matches pages in the category with the slug.
+type InCategory struct {
+	Slug string
+}
+
+// InNamespace matches pages in the namespace, named by its key like 14 or
+// its slugged name like category.
+type InNamespace struct {
+	Name string
+}
+
+// InInfobox matches pages with every word in the value of their infobox's
+// field with the key.
+type InInfobox struct {
+	Key   string
+	Words []string
+}
+
+// And matches pages every child matches.
+type And struct {
+	Children []Node
+}
+
+// Or matches pages any child matches.
+type Or struct {
+	Children []Node
+}
+
+// Not matches pages the child doesn't.
+type Not struct {
+	Child Node
+}
+
+// Clauses are written side by side. Pages have to match all of Must and none
+// of MustNot, and if there's nothing in Must, one of Should. Should clauses
+// that aren't required still count towards ranking.
+type Clauses struct {
+	Should  []Node
+	Must    []Node
+	MustNot []Node
+	// Filter clauses, like ns:14, narrow down what the rest of the clauses
+	// match without counting as one of the optional clauses.
+	Filter []Node
+}
+
+func (Term) node()        {}
+func (Phrase) node()      {}
+func (Near) node()        {}
+func (InTitle) node()     {}
+func (InCategory) node()  {}
+func (InInfobox) node()   {}
+func (InNamespace) node() {}
+func (And) node()         {}
+func (Or) node()          {}
+func (Not) node()         {}
+func (Clauses) node()     {}
+
+// Terms is every distinct word a page can be ranked on, in the order they
+// first appear. Words only under a NOT or - are left out.
+func Terms(n Node) []string {
+	seen := map[string]struct{}{}
+	var terms []string
+	add := func(words ...string) {
+		for _, w := range words {
+			if _, ok := seen[w]; ok {
+				continue
+			}
+			seen[w] = struct{}{}
+			terms = append(terms, w)
+		}
+	}
+	var walk func(n Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case Term:
+			add(n.Word)
+		case Phrase:
+			add(n.Words...)
+		case Near:
+			add(n.Left, n.Right)
+		case InTitle:
+			add(n.Words...)
+		case InInfobox:
+			add(n.Words...)
+		case And:
+			for _, c := range n.Children {
+				walk(c)
+			}
+		case Or:
+			for _, c := range n.Children {
+				walk(c)
+			}
+		case Clauses:
+			for _, c := range n.Must {
+				walk(c)
+			}
+			for _, c := range n.Should {
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	return terms
+}
+
+// isFilter reports whether the node only narrows down results, having no
+// words of its own.
+func isFilter(n Node) bool {
+	all := func(nodes []Node) bool {
+		for _, c := range nodes {
+			if !isFilter(c) {
+				return false
+			}
+		}
+		return true
+	}
+	switch n := n.(type) {
+	case InNamespace, InCategory:
+		return true
+	case Not:
+		return isFilter(n.Child)
+	case And:
+		return all(n.Children)
+	case Or:
+		return all(n.Children)
+	case Clauses:
+		return all(n.Should) && all(n.Must) && all(n.MustNot) && all(n.Filter)
+	default:
+		return false
+	}
+}
+
+// Namespaces is the names of every namespace the query filters on.
+func Namespaces(n Node) []string {
+	var names []string
+	var walk func(n Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case InNamespace:
+			names = append(names, n.Name)
+		case Not:
+			walk(n.Child)
+		case And:
+			for _, c := range n.Children {
+				walk(c)
+			}
+		case Or:
+			for _, c := range n.Children {
+				walk(c)
+			}
+		case Clauses:
+			for _, cs := range [][]Node{n.Must, n.Should, n.MustNot, n.Filter} {
+				for _, c := range cs {
+					walk(c)
+				}
+			}
+		}
+	}
+	walk(n)
+	return names
+}
+
+// Canonical writes the query back out in one normal form, so queries that
+// only differ in case, spacing or redundant parentheses come out the same.
+func Canonical(n Node) string {
+	var b strings.Builder
+	writeCanonical(&b, n)
+	return b.String()
+}
+
+func writeCanonical(b *strings.Builder, n Node) {
+	group := func(op string, children []Node) {
+		b.WriteString("(")
+		for i, c := range children {
+			if i > 0 {
+				b.WriteString(op)
+			}
+			writeCanonical(b, c)
+		}
+		b.WriteString(")")
+	}
+	switch n := n.(type) {
+	case Term:
+		b.WriteString(n.Word)
+	case Phrase:
+		fmt.Fprintf(b, "%q", strings.Join(n.Words, " "))
+	case Near:
+		fmt.Fprintf(b, "%s NEAR/%d %s", n.Left, n.Distance, n.Right)
+	case InTitle:
+		fmt.Fprintf(b, "intitle:%q", strings.Join(n.Words, " "))
+	case InCategory:
+		fmt.Fprintf(b, "incategory:%q", n.Slug)
+	case InNamespace:
+		fmt.Fprintf(b, "ns:%q", n.Name)
+	case InInfobox:
+		fmt.Fprintf(b, "infobox.%s:%q", n.Key, strings.Join(n.Words, " "))
+	case And:
+		group(" AND ", n.Children)
+	case Or:
+		group(" OR ", n.Children)
+	case Not:
+		b.WriteString("NOT ")
+		writeCanonical(b, n.Child)
+	case Clauses:
+		b.WriteString("(")
+		first := true
+		for _, occur := range []struct {
+			prefix string
+			nodes  []Node
+		}{{"", n.Should}, {"", n.Filter}, {"+", n.Must}, {"-", n.MustNot}} {
+			for _, c := range occur.nodes {
+				if !first {
+					b.WriteString(" ")
+				}
+				first = false
+				b.WriteString(occur.prefix)
+				writeCanonical(b, c)
+			}
+		}
+		b.WriteString(")")
+	}
+}
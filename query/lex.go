@@ -0,0 +1,160 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/samiam2013/wiki4dummies/normalize"
+)
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokPhrase
+	tokNear
+	tokAnd
+	tokOr
+	tokNot
+	tokRequired // + prefix
+	tokExcluded // - prefix
+	tokLParen
+	tokRParen
+	tokField // name:value, like intitle:word or intitle:"some words"
+)
+
+type token struct {
+	kind     tokenKind
+	words    []string // one for a word, every word of a phrase or field value
+	distance int      // for NEAR
+	field    string   // the name of a field operator
+	value    string   // a field operator's value as written
+}
+
+// defaultNearDistance is used for a bare NEAR without a /n.
+const defaultNearDistance = 10
+
+// operators have to be uppercase so the words "and", "or", "not" and "near"
+// can still be searched for.
+var operators = map[string]tokenKind{
+	"AND": tokAnd,
+	"OR":  tokOr,
+	"NOT": tokNot,
+}
+
+// fieldOperators are the name: prefixes that restrict a value to something
+// other than the page text.
+var fieldOperators = map[string]struct{}{
+	"intitle":    {},
+	"incategory": {},
+	"ns":         {},
+}
+
+// infoboxPrefix starts the field operators searching an infobox field, like
+// infobox.birth_place:london.
+const infoboxPrefix = "infobox."
+
+func isFieldOperator(name string) bool {
+	if key, ok := strings.CutPrefix(name, infoboxPrefix); ok {
+		return normalize.InfoboxKey(key) != ""
+	}
+	_, ok := fieldOperators[name]
+	return ok
+}
+
+// lex splits a query into words, quoted phrases and operators. Words are
+// lowercased and split the same way page text is, a word that splits in
+// several like "Jean-Paul" is treated as a phrase.
+func lex(q string) []token {
+	tokens := make([]token, 0, 8)
+	rs := []rune(q)
+	for i := 0; i < len(rs); {
+		switch {
+		case unicode.IsSpace(rs[i]):
+			i++
+		case rs[i] == '(':
+			tokens = append(tokens, token{kind: tokLParen})
+			i++
+		case rs[i] == ')':
+			tokens = append(tokens, token{kind: tokRParen})
+			i++
+		case rs[i] == '"':
+			end := i + 1
+			for end < len(rs) && rs[end] != '"' {
+				end++
+			}
+			words := normalize.SplitAndLower(string(rs[i+1 : end]))
+			if len(words) > 0 {
+				tokens = append(tokens, token{kind: tokPhrase, words: words})
+			}
+			i = end + 1
+		case (rs[i] == '+' || rs[i] == '-') && i+1 < len(rs) && !unicode.IsSpace(rs[i+1]):
+			kind := tokRequired
+			if rs[i] == '-' {
+				kind = tokExcluded
+			}
+			tokens = append(tokens, token{kind: kind})
+			i++
+		default:
+			end := i
+			for end < len(rs) && !unicode.IsSpace(rs[end]) && !strings.ContainsRune(`"()`, rs[end]) {
+				end++
+			}
+			raw := string(rs[i:end])
+			i = end
+			if name, value, ok := strings.Cut(raw, ":"); ok {
+				if isFieldOperator(name) {
+					// a quoted value follows straight after the colon
+					if value == "" && i < len(rs) && rs[i] == '"' {
+						end = i + 1
+						for end < len(rs) && rs[end] != '"' {
+							end++
+						}
+						value = string(rs[i+1 : end])
+						i = end + 1
+					}
+					t := token{kind: tokField, field: name, words: normalize.SplitAndLower(value), value: value}
+					// category names and namespaces are matched by slug, which
+					// keeps digits
+					if len(t.words) > 0 || (name != "intitle" && normalize.Slug(value) != "") {
+						tokens = append(tokens, t)
+					}
+					continue
+				}
+			}
+			if kind, ok := operators[raw]; ok {
+				tokens = append(tokens, token{kind: kind})
+				continue
+			}
+			if distance, ok := parseNear(raw); ok {
+				tokens = append(tokens, token{kind: tokNear, distance: distance})
+				continue
+			}
+			switch words := normalize.SplitAndLower(raw); len(words) {
+			case 0:
+			case 1:
+				tokens = append(tokens, token{kind: tokWord, words: words})
+			default:
+				tokens = append(tokens, token{kind: tokPhrase, words: words})
+			}
+		}
+	}
+	return tokens
+}
+
+// parseNear recognizes NEAR and NEAR/n.
+func parseNear(raw string) (int, bool) {
+	if raw == "NEAR" {
+		return defaultNearDistance, true
+	}
+	distStr, ok := strings.CutPrefix(raw, "NEAR/")
+	if !ok {
+		return 0, false
+	}
+	distance, err := strconv.Atoi(distStr)
+	if err != nil || distance < 1 {
+		return 0, false
+	}
+	return distance, true
+}
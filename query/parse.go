@@ -0,0 +1,225 @@
+// Package query parses what's typed into the search box.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/samiam2013/wiki4dummies/normalize"
+)
+
+// ErrEmptyQuery is returned for queries with nothing to search for, like
+// only punctuation.
+var ErrEmptyQuery = errors.New("query has no words to search for")
+
+// Parse turns a query into a tree the search engine can evaluate.
+//
+//	query   = clause { clause }
+//	clause  = [ "+" | "-" ] or
+//	or      = and { "OR" and }
+//	and     = unary { "AND" unary }
+//	unary   = ( "NOT" | "-" | "+" ) unary | primary
+//	primary = word [ "NEAR" word ] | phrase | field | "(" query ")"
+//	field   = ( "intitle:" | "incategory:" | "ns:" | "infobox." key ":" ) ( word | phrase )
+//
+// Clauses side by side are optional unless marked with + or -, a NOT
+// clause is the same as -. Clauses that only filter, like ns: and
+// incategory:, always narrow down the results.
+func Parse(q string) (Node, error) {
+	p := &parser{tokens: lex(q)}
+	if len(p.tokens) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	n, err := p.clauses()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, errors.New("unbalanced parentheses in query")
+	}
+	return n, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.done() {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// accept consumes the next token if it's of the kind.
+func (p *parser) accept(kind tokenKind) bool {
+	if t, ok := p.peek(); ok && t.kind == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) clauses() (Node, error) {
+	var c Clauses
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == tokRParen {
+			break
+		}
+		occur := &c.Should
+		if p.accept(tokRequired) {
+			occur = &c.Must
+		} else if p.accept(tokExcluded) {
+			occur = &c.MustNot
+		}
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if not, ok := n.(Not); ok && occur == &c.Should {
+			occur, n = &c.MustNot, not.Child
+		}
+		if occur == &c.Should && isFilter(n) {
+			occur = &c.Filter
+		}
+		*occur = append(*occur, n)
+	}
+	switch len(c.Should) + len(c.Must) + len(c.MustNot) + len(c.Filter) {
+	case 0:
+		return nil, ErrEmptyQuery
+	case 1:
+		if len(c.Should) == 1 {
+			return c.Should[0], nil
+		}
+		if len(c.Filter) == 1 {
+			return c.Filter[0], nil
+		}
+	}
+	return c, nil
+}
+
+func (p *parser) or() (Node, error) {
+	n, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	children := []Node{n}
+	for p.accept(tokOr) {
+		n, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, n)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return Or{Children: children}, nil
+}
+
+func (p *parser) and() (Node, error) {
+	n, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	children := []Node{n}
+	for p.accept(tokAnd) {
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, n)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return And{Children: children}, nil
+}
+
+func (p *parser) unary() (Node, error) {
+	if p.accept(tokNot) || p.accept(tokExcluded) {
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{Child: n}, nil
+	}
+	if p.accept(tokRequired) {
+		return p.unary()
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Node, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, errors.New("query ends where a word was expected")
+	}
+	p.pos++
+	switch t.kind {
+	case tokWord:
+		near, ok := p.peek()
+		if !ok || near.kind != tokNear {
+			return Term{Word: t.words[0]}, nil
+		}
+		p.pos++
+		right, ok := p.peek()
+		if !ok || right.kind != tokWord {
+			return nil, errors.New("NEAR needs a word on both sides")
+		}
+		p.pos++
+		return Near{Left: t.words[0], Right: right.words[0], Distance: near.distance}, nil
+	case tokPhrase:
+		return Phrase{Words: t.words}, nil
+	case tokField:
+		switch t.field {
+		case "incategory":
+			return InCategory{Slug: normalize.Slug(t.value)}, nil
+		case "ns":
+			return InNamespace{Name: normalize.Slug(t.value)}, nil
+		}
+		if key, ok := strings.CutPrefix(t.field, infoboxPrefix); ok {
+			return InInfobox{Key: normalize.InfoboxKey(key), Words: t.words}, nil
+		}
+		return InTitle{Words: t.words}, nil
+	case tokLParen:
+		n, err := p.clauses()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(tokRParen) {
+			return nil, errors.New("unbalanced parentheses in query")
+		}
+		return n, nil
+	case tokNear:
+		return nil, errors.New("NEAR needs a word on both sides")
+	default:
+		return nil, fmt.Errorf("unexpected %s in query", t.kind)
+	}
+}
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokAnd:
+		return "AND"
+	case tokOr:
+		return "OR"
+	case tokNot:
+		return "NOT"
+	case tokRequired:
+		return "+"
+	case tokExcluded:
+		return "-"
+	case tokRParen:
+		return ")"
+	default:
+		return "token"
+	}
+}
@@ -0,0 +1,148 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name, q string
+		want    string // Canonical of the parsed query
+	}{
+		{"word", "Plant", "plant"},
+		{"words side by side", "Green Plants", "(green plants)"},
+		{"lowercase operators are words", "near and or not", "(near and or not)"},
+
+		// AND binds tighter than OR, which binds tighter than clauses
+		{"AND before OR", "a OR b AND c", "(a OR (b AND c))"},
+		{"AND before OR, left", "a AND b OR c", "((a AND b) OR c)"},
+		{"parentheses", "(a OR b) AND c", "((a OR b) AND c)"},
+		{"OR before clauses", "a OR b c", "((a OR b) c)"},
+		{"redundant parentheses", "((a)) AND (((b)))", "(a AND b)"},
+
+		{"required and excluded", "+a b -c", "(b +a -c)"},
+		{"NOT clause is excluded", "NOT a b", "(b -a)"},
+		{"double negation", "NOT NOT a", "(-NOT a)"},
+		{"NOT inside OR", "-(a OR NOT b) c", "(c -(a OR NOT b))"},
+		{"nested negation", "NOT (a AND NOT (b OR -c))", "(-(a AND NOT (b OR NOT c)))"},
+		{"NOT binds tighter than AND", "NOT a AND b", "(NOT a AND b)"},
+		{"lone minus", "- a", "a"},
+
+		{"phrase", `"Green  Plants" leaf`, `("green plants" leaf)`},
+		{"unterminated phrase", `"green plants`, `"green plants"`},
+		{"hyphenated word", "Jean-Paul", `"jean paul"`},
+		{"empty phrase", `"  " plant`, "plant"},
+		{"required phrase", `+"green plants"`, `(+"green plants")`},
+
+		{"NEAR", "a NEAR b", "a NEAR/10 b"},
+		{"NEAR distance", "a NEAR/3 b", "a NEAR/3 b"},
+		{"NEAR zero is a word", "a NEAR/0 b", "(a near b)"},
+		{"NEAR in OR", "a NEAR/2 b OR c", "(a NEAR/2 b OR c)"},
+
+		{"intitle", "intitle:plant", `intitle:"plant"`},
+		{"intitle phrase", `intitle:"Green Plant"`, `intitle:"green plant"`},
+		{"incategory", `incategory:"Flowering plants"`, `incategory:"flowering-plants"`},
+		{"ns filters", "ns:14 plant", `(plant ns:"14")`},
+		{"filters alone", "ns:14", `ns:"14"`},
+		{"excluded ns", "plant -ns:category", `(plant -ns:"category")`},
+		{"infobox", "infobox.Birth_Place:London", `infobox.birth_place:"london"`},
+		{"unknown field", "foo:bar", `"foo bar"`},
+		{"infobox without a key", "infobox.:x", `"infobox x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := Parse(tt.q)
+			if err != nil {
+				t.Fatalf("Parse(%q) = %v", tt.q, err)
+			}
+			if got := Canonical(n); got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	n, err := Parse(`+intitle:plant (leaf OR "green stem") -NOT ns:1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Clauses{
+		Should: []Node{Or{Children: []Node{Term{Word: "leaf"}, Phrase{Words: []string{"green", "stem"}}}}},
+		Must:   []Node{InTitle{Words: []string{"plant"}}},
+		// excluding pages outside namespace 1 only filters
+		MustNot: []Node{Not{Child: InNamespace{Name: "1"}}},
+	}
+	if !reflect.DeepEqual(n, want) {
+		t.Errorf("Parse() = %#v\nwant %#v", n, want)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		q     string
+		empty bool // ErrEmptyQuery rather than a syntax error
+	}{
+		{"", true},
+		{"   ", true},
+		{"!!!", true},
+		{`""`, true},
+		{"+", true},
+		{"()", true},
+		{")", true},
+		{"intitle:", true},
+		{"(a", false},
+		{"a)", false},
+		{"((a) b", false},
+		{"a AND", false},
+		{"OR a", false},
+		{"AND", false},
+		{"NOT", false},
+		{"a NEAR", false},
+		{"NEAR b", false},
+		{`a NEAR "b c"`, false},
+		{"a AND OR b", false},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.q)
+		if err == nil {
+			t.Errorf("Parse(%q) = %s, want an error", tt.q, Canonical(n))
+			continue
+		}
+		if errors.Is(err, ErrEmptyQuery) != tt.empty {
+			t.Errorf("Parse(%q) = %v, ErrEmptyQuery %t", tt.q, err, tt.empty)
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, q := range []string{`+a (b OR "c d") -NOT e`, "a NEAR/3 b", `intitle:"x`, "((", "-+-a", "infobox.x:"} {
+		f.Add(q)
+	}
+	f.Fuzz(func(t *testing.T, q string) {
+		n, err := Parse(q)
+		if err == nil {
+			// the canonical form means the same query
+			again, err := Parse(Canonical(n))
+			if err != nil {
+				t.Fatalf("Parse(Canonical(%q)) = %v", q, err)
+			}
+			if Canonical(again) != Canonical(n) {
+				t.Errorf("Canonical(%q) = %s, then %s", q, Canonical(n), Canonical(again))
+			}
+		}
+	})
+}
+
+func TestTerms(t *testing.T) {
+	n, err := Parse(`plant OR "green plant" +intitle:leaf -soil NOT (root AND stem) ns:14 infobox.genus:rosa`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"leaf", "plant", "green", "rosa"}
+	if got := Terms(n); !reflect.DeepEqual(got, want) {
+		t.Errorf("Terms() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/wiki"
+)
+
+var ErrDifferentWiki = errors.New("dump is from a different wiki")
+
+// dumpNameRE matches dump file names, like
+// enwiki-20241001-pages-meta-hist-incr.xml.bz2, capturing the date.
+var dumpNameRE = regexp.MustCompile(`^[a-z_]+-([0-9]{8})-`)
+
+// dumpDate is the date a dump was made, from its file name.
+func dumpDate(dumpPath string) (string, bool) {
+	m := dumpNameRE.FindStringSubmatch(filepath.Base(dumpPath))
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// recordDumpDate records the dump as the last one applied in the manifest,
+// unless a later one already was. Ingesting an older dump in full never
+// moves the date back, which would let older incremental dumps be applied.
+func recordDumpDate(savePath string, m index.Manifest, dumpPath string) error {
+	date, ok := dumpDate(dumpPath)
+	if !ok || date <= m.LastDumpDate {
+		return nil
+	}
+	m.LastDumpDate = date
+	return index.WriteManifest(savePath, m)
+}
+
+// checkUpdate checks an incremental dump can be applied to the index in
+// savePath: the index has to exist and the dump can't be older than the last
+// one applied, so the manifest's date is always how current the index is.
+func checkUpdate(savePath, dumpPath string) error {
+	m, err := index.ReadManifest(savePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return errors.New("there's no index to update, ingest a full dump first")
+	}
+	if err != nil {
+		return err
+	}
+	date, ok := dumpDate(dumpPath)
+	if !ok {
+		return fmt.Errorf("failed to read the date of dump %s from its name", filepath.Base(dumpPath))
+	}
+	if date < m.LastDumpDate {
+		return fmt.Errorf("dump of %s is older than the last one applied, of %s", date, m.LastDumpDate)
+	}
+	return nil
+}
+
+// readDumpSiteinfo reads the siteinfo from the start of the dump, which is
+// the first stream of a multistream dump.
+func readDumpSiteinfo(dumpPath string) (wiki.Siteinfo, error) {
+	fh, err := os.Open(dumpPath)
+	if err != nil {
+		return wiki.Siteinfo{}, fmt.Errorf("failed to open dump file: %w", err)
+	}
+	defer func() { _ = fh.Close() }()
+	return wiki.ReadSiteinfo(bzip2.NewReader(fh))
+}
+
+func manifestFromSiteinfo(si wiki.Siteinfo) (index.Manifest, error) {
+	m := index.Manifest{
+		DBName:    si.Dbname,
+		Sitename:  si.Sitename,
+		Base:      si.Base,
+		Generator: si.Generator,
+		Case:      si.Case,
+	}
+	for _, ns := range si.Namespaces.Namespace {
+		key, err := strconv.Atoi(ns.Key)
+		if err != nil {
+			return index.Manifest{}, fmt.Errorf("failed to parse namespace key %q: %w", ns.Key, err)
+		}
+		m.Namespaces = append(m.Namespaces, index.Namespace{
+			Key:  key,
+			Name: strings.TrimSpace(ns.Text),
+			Case: ns.Case,
+		})
+	}
+	if _, ok := m.Namespace("0"); !ok {
+		return index.Manifest{}, errors.New("siteinfo has no main namespace")
+	}
+	return m, nil
+}
+
+// openManifest returns the manifest of the index in savePath, writing m as
+// the manifest of a new one. A dump of a different wiki than the one already
+// indexed is refused, as is adding to an index built incompatibly or with
+// positions recorded when the new pages wouldn't have them, or the other way
+// around.
+func openManifest(savePath string, m index.Manifest, positions bool) (index.Manifest, error) {
+	current := index.CurrentBuild()
+	current.Positions = positions
+	existing, err := index.ReadManifest(savePath)
+	if errors.Is(err, os.ErrNotExist) {
+		// an index from before manifests has docs but nothing saying how
+		// they were indexed
+		if _, err := os.Stat(filepath.Join(savePath, constants.DocTableFolder)); err == nil {
+			return index.Manifest{}, fmt.Errorf("failed to add to index, rebuild it: %w: no manifest",
+				index.ErrIncompatibleIndex)
+		}
+		m.Build = current
+		if err := index.WriteManifest(savePath, m); err != nil {
+			return index.Manifest{}, err
+		}
+		return m, nil
+	}
+	if err != nil {
+		return index.Manifest{}, err
+	}
+	if existing.DBName != m.DBName {
+		return index.Manifest{}, fmt.Errorf("%w: %s is indexed, the dump is %s", ErrDifferentWiki,
+			existing.DBName, m.DBName)
+	}
+	if err := existing.Build.Compatible(current); err != nil {
+		return index.Manifest{}, fmt.Errorf("failed to add to index, rebuild it: %w", err)
+	}
+	if existing.Build.Positions != positions {
+		return index.Manifest{}, fmt.Errorf("%w: positions recorded is %t, -positions is %t",
+			index.ErrIncompatibleIndex, existing.Build.Positions, positions)
+	}
+	return existing, nil
+}
+
+// parseNamespaces parses a comma separated list of namespace keys, each of
+// which must be in the manifest.
+func parseNamespaces(list string, m index.Manifest) (map[int]struct{}, error) {
+	namespaces := map[int]struct{}{}
+	for _, key := range strings.Split(list, ",") {
+		key = strings.TrimSpace(key)
+		ns, ok := m.Namespace(key)
+		if !ok {
+			return nil, fmt.Errorf("%s isn't a namespace of %s", key, m.DBName)
+		}
+		namespaces[ns.Key] = struct{}{}
+	}
+	return namespaces, nil
+}
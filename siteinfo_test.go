@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/samiam2013/wiki4dummies/constants"
+	"github.com/samiam2013/wiki4dummies/index"
+	"github.com/samiam2013/wiki4dummies/wiki"
+)
+
+func TestDumpDate(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"/dumps/enwiki-20241001-pages-meta-hist-incr.xml.bz2", "20241001", true},
+		{"enwiki-20240901-pages-articles-multistream.xml.bz2", "20240901", true},
+		{"dump.xml.bz2", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := dumpDate(tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("dumpDate(%q) = %q, %t, want %q, %t", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRecordDumpDateNeverGoesBack(t *testing.T) {
+	savePath := t.TempDir()
+	m := index.Manifest{DBName: "enwiki", Build: index.CurrentBuild()}
+	if err := index.WriteManifest(savePath, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordDumpDate(savePath, m, "enwiki-20241002-pages-meta-hist-incr.xml.bz2"); err != nil {
+		t.Fatal(err)
+	}
+	m, err := index.ReadManifest(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.LastDumpDate != "20241002" {
+		t.Fatalf("LastDumpDate = %q after an update, want 20241002", m.LastDumpDate)
+	}
+
+	// re-ingesting an older full dump keeps the date of the newest
+	if err := recordDumpDate(savePath, m, "enwiki-20240901-pages-articles-multistream.xml.bz2"); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = index.ReadManifest(savePath); err != nil {
+		t.Fatal(err)
+	}
+	if m.LastDumpDate != "20241002" {
+		t.Fatalf("LastDumpDate = %q after an older dump, want 20241002", m.LastDumpDate)
+	}
+	if err := checkUpdate(savePath, "enwiki-20241001-pages-meta-hist-incr.xml.bz2"); err == nil {
+		t.Error("checkUpdate accepted a dump older than the last one applied")
+	}
+	if err := checkUpdate(savePath, "enwiki-20241003-pages-meta-hist-incr.xml.bz2"); err != nil {
+		t.Errorf("checkUpdate refused a newer dump: %v", err)
+	}
+}
+
+func TestCheckUpdateNeedsAnIndex(t *testing.T) {
+	if err := checkUpdate(t.TempDir(), "enwiki-20241001-pages-meta-hist-incr.xml.bz2"); err == nil {
+		t.Error("checkUpdate accepted a save path without an index")
+	}
+}
+
+func TestOpenManifestRefusesUnrecordedBuilds(t *testing.T) {
+	m := index.Manifest{DBName: "enwiki", Namespaces: []index.Namespace{{Key: 0}}}
+
+	// a new index gets this build
+	savePath := t.TempDir()
+	got, err := openManifest(savePath, m, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Build != index.CurrentBuild() {
+		t.Errorf("new index build = %+v, want %+v", got.Build, index.CurrentBuild())
+	}
+	if _, err := openManifest(savePath, m, false); err != nil {
+		t.Errorf("reopening the index: %v", err)
+	}
+
+	// a manifest from before builds were recorded
+	savePath = t.TempDir()
+	if err := index.WriteManifest(savePath, m); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openManifest(savePath, m, false); !errors.Is(err, index.ErrIncompatibleIndex) {
+		t.Errorf("openManifest() = %v, want ErrIncompatibleIndex", err)
+	}
+
+	// an index from before manifests
+	savePath = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(savePath, constants.DocTableFolder), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openManifest(savePath, m, false); !errors.Is(err, index.ErrIncompatibleIndex) {
+		t.Errorf("openManifest() = %v, want ErrIncompatibleIndex", err)
+	}
+
+	// another wiki
+	savePath = t.TempDir()
+	if _, err := openManifest(savePath, m, false); err != nil {
+		t.Fatal(err)
+	}
+	other := m
+	other.DBName = "dewiki"
+	if _, err := openManifest(savePath, other, false); !errors.Is(err, ErrDifferentWiki) {
+		t.Errorf("openManifest() = %v, want ErrDifferentWiki", err)
+	}
+}
+
+func TestOpenManifestPositions(t *testing.T) {
+	m := index.Manifest{DBName: "enwiki", Namespaces: []index.Namespace{{Key: 0}}}
+	savePath := t.TempDir()
+	got, err := openManifest(savePath, m, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Build.Positions {
+		t.Error("new index built with positions doesn't record them")
+	}
+	if _, err := openManifest(savePath, m, true); err != nil {
+		t.Errorf("reopening the index with positions: %v", err)
+	}
+	if _, err := openManifest(savePath, m, false); !errors.Is(err, index.ErrIncompatibleIndex) {
+		t.Errorf("openManifest() without positions = %v, want ErrIncompatibleIndex", err)
+	}
+
+	savePath = t.TempDir()
+	if _, err := openManifest(savePath, m, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openManifest(savePath, m, true); !errors.Is(err, index.ErrIncompatibleIndex) {
+		t.Errorf("openManifest() with positions = %v, want ErrIncompatibleIndex", err)
+	}
+}
+
+// testSiteinfo parses the siteinfo of a wiki with the namespaces, written as
+// <namespace> elements.
+func testSiteinfo(t *testing.T, namespaces string) wiki.Siteinfo {
+	t.Helper()
+	si, err := wiki.ReadSiteinfo(strings.NewReader(`<siteinfo>
+    <sitename>Wikipedia</sitename>
+    <dbname>enwiki</dbname>
+    <base>https://en.wikipedia.org/wiki/Main_Page</base>
+    <generator>MediaWiki 1.43.0-wmf.20</generator>
+    <case>first-letter</case>
+    <namespaces>
+` + namespaces + `
+    </namespaces>
+  </siteinfo>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return si
+}
+
+func TestManifestFromSiteinfo(t *testing.T) {
+	m, err := manifestFromSiteinfo(testSiteinfo(t, `<namespace key="0" case="first-letter" />
+<namespace key="14" case="first-letter"> Category </namespace>
+<namespace key="-1" case="case-sensitive">Special</namespace>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := index.Manifest{
+		DBName:    "enwiki",
+		Sitename:  "Wikipedia",
+		Base:      "https://en.wikipedia.org/wiki/Main_Page",
+		Generator: "MediaWiki 1.43.0-wmf.20",
+		Case:      "first-letter",
+		Namespaces: []index.Namespace{
+			{Key: 0, Case: "first-letter"},
+			{Key: 14, Name: "Category", Case: "first-letter"},
+			{Key: -1, Name: "Special", Case: "case-sensitive"},
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("manifest = %+v, want %+v", m, want)
+	}
+
+	if _, err := manifestFromSiteinfo(testSiteinfo(t, `<namespace key="14">Category</namespace>`)); err == nil {
+		t.Error("manifestFromSiteinfo accepted a wiki without a main namespace")
+	}
+	if _, err := manifestFromSiteinfo(testSiteinfo(t, `<namespace key="0" /><namespace key="x">Bad</namespace>`)); err == nil {
+		t.Error("manifestFromSiteinfo accepted a namespace key that isn't a number")
+	}
+}
+
+func TestParseNamespaces(t *testing.T) {
+	tests := []struct {
+		list string
+		want map[int]struct{}
+	}{
+		{"0", map[int]struct{}{0: {}}},
+		{"0, 14,14", map[int]struct{}{0: {}, 14: {}}},
+		{"0,2", nil},
+		{"category", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := parseNamespaces(tt.list, testManifest)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("parseNamespaces(%q) = %v, want an error", tt.list, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseNamespaces(%q) = %v, %v, want %v", tt.list, got, err, tt.want)
+		}
+	}
+}
@@ -2,8 +2,13 @@ package wiki
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"maps"
+	"slices"
+	"strings"
 
 	"github.com/samiam2013/wiki4dummies/normalize"
 )
@@ -30,6 +35,13 @@ var FrequentWords = map[string]struct{}{
 	"since": {}, "problem": {}, "best": {}, "part": {}, "yes": {}, "guy": {}, "bad": {}, "far": {}, "hold": {}, "stop": {}, "next": {},
 	"bring": {}, "week": {}, "ever": {}, "head": {}, "without": {}, "lot ": {}}
 
+// StopwordsHash identifies the FrequentWords list, so an index can tell when
+// it was built leaving out different words than are left out of queries.
+func StopwordsHash() string {
+	sum := sha256.Sum256([]byte(strings.Join(slices.Sorted(maps.Keys(FrequentWords)), "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
 func GatherWordFrequency(r io.Reader) (map[string]int, error) {
 	s := bufio.NewScanner(r)
 	s.Buffer(make([]byte, 0, 64*1024), 100*100*1024)
@@ -48,3 +60,17 @@ func GatherWordFrequency(r io.Reader) (map[string]int, error) {
 	}
 	return wordFreq, nil
 }
+
+// WordPositions returns the token offsets of every word in text that isn't a
+// frequent word. Frequent words still take up a position, so the words of a
+// phrase like "bank of america" stay two apart.
+func WordPositions(text string) map[string][]uint32 {
+	positions := make(map[string][]uint32)
+	for i, word := range normalize.SplitAndLower(text) {
+		if _, ok := FrequentWords[word]; ok {
+			continue
+		}
+		positions[word] = append(positions[word], uint32(i))
+	}
+	return positions
+}
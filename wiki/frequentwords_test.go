@@ -0,0 +1,31 @@
+package wiki
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWordPositions(t *testing.T) {
+	got := WordPositions("Bank of America is a bank; the Bank-of-America tower.")
+	want := map[string][]uint32{
+		"bank":    {0, 5, 7},
+		"america": {2, 9},
+		"tower":   {10},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WordPositions() = %v, want %v", got, want)
+	}
+}
+
+func TestGatherWordFrequencySkipsLongWords(t *testing.T) {
+	dna := strings.Repeat("gatc", 80)
+	got, err := GatherWordFrequency(strings.NewReader("The sequence " + dna + " codes a protein."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"sequence": 1, "codes": 1, "protein": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GatherWordFrequency() = %v, want %v", got, want)
+	}
+}
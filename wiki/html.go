@@ -0,0 +1,448 @@
+package wiki
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// LinkFunc gives the URL an internal link to the title should point at.
+type LinkFunc func(title string) string
+
+// Section is a heading of a rendered article.
+type Section struct {
+	Level  int // 2 for ==, up to 6
+	Title  string
+	Anchor string // the heading's id
+}
+
+// Rendered is an article's wikitext as HTML.
+type Rendered struct {
+	HTML       string
+	Sections   []Section
+	Categories []string // the names of the categories the article is in
+}
+
+var (
+	commentRE   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	refRE       = regexp.MustCompile(`(?is)<ref[^>]*/>|<ref[^>]*>.*?</ref>`)
+	dropBlockRE = regexp.MustCompile(`(?is)<(gallery|math|timeline|score)[^>]*>.*?</(gallery|math|timeline|score)>`)
+	magicWordRE = regexp.MustCompile(`__[A-Z]+__`)
+	headingRE   = regexp.MustCompile(`^(={1,6})\s*(.*?)\s*(={1,6})\s*$`)
+	htmlTagRE   = regexp.MustCompile(`^</?([a-zA-Z][a-zA-Z0-9]*)[^>]*?/?>`)
+	entityRE    = regexp.MustCompile(`^&(#[0-9]+|#x[0-9a-fA-F]+|[a-zA-Z]+);`)
+	anyTagRE    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// keptTags are the inline HTML tags passed through, without attributes.
+// Anything else is dropped, keeping what's inside it.
+var keptTags = map[string]struct{}{
+	"br": {}, "sub": {}, "sup": {}, "small": {}, "s": {}, "u": {}, "code": {}, "b": {}, "i": {},
+}
+
+// droppedNamespaces are links that aren't rendered in the text at all.
+var droppedNamespaces = []string{"file:", "image:", "media:", "category:"}
+
+// RenderHTML renders an article's wikitext as HTML: headings, paragraphs,
+// lists, tables and links. Templates, references and comments are left out,
+// the infobox is rendered separately.
+func RenderHTML(text string, link LinkFunc) Rendered {
+	text = commentRE.ReplaceAllString(text, "")
+	text = refRE.ReplaceAllString(text, "")
+	text = dropBlockRE.ReplaceAllString(text, "")
+	text = StripTemplates(text)
+	text = magicWordRE.ReplaceAllString(text, "")
+
+	r := &renderer{link: link, anchors: map[string]int{}}
+	for _, line := range strings.Split(text, "\n") {
+		r.line(line)
+	}
+	// a table left open at the end is closed like any other block
+	r.closeTable()
+	r.closeBlocks()
+	return Rendered{HTML: r.b.String(), Sections: r.sections, Categories: r.categories}
+}
+
+// RenderInline renders a single line of wikitext, like an infobox value.
+func RenderInline(text string, link LinkFunc) string {
+	text = commentRE.ReplaceAllString(text, "")
+	text = refRE.ReplaceAllString(text, "")
+	text = StripTemplates(text)
+	r := &renderer{link: link}
+	return strings.TrimSpace(r.inline(text))
+}
+
+// PlainText is a single line of wikitext as plain text, links replaced by
+// their labels and every tag and template left out.
+func PlainText(text string) string {
+	rendered := RenderInline(text, func(string) string { return "" })
+	return strings.TrimSpace(html.UnescapeString(anyTagRE.ReplaceAllString(rendered, "")))
+}
+
+type renderer struct {
+	b          strings.Builder
+	link       LinkFunc
+	sections   []Section
+	anchors    map[string]int
+	categories []string
+
+	paragraph []string // lines of the open paragraph
+	lists     string   // list markers of the open lists, like "*#"
+	table     bool
+	row       []string // cells of the open table row
+}
+
+func (r *renderer) line(line string) {
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case r.table || strings.HasPrefix(trimmed, "{|"):
+		r.tableLine(trimmed)
+	case trimmed == "":
+		r.closeBlocks()
+	case headingRE.MatchString(trimmed):
+		m := headingRE.FindStringSubmatch(trimmed)
+		r.closeBlocks()
+		r.heading(min(len(m[1]), len(m[3])), m[2])
+	case strings.HasPrefix(trimmed, "----"):
+		r.closeBlocks()
+		r.b.WriteString("<hr>\n")
+	case strings.ContainsRune("*#:;", rune(trimmed[0])):
+		r.closeParagraph()
+		r.listItem(trimmed)
+	default:
+		r.closeLists()
+		r.paragraph = append(r.paragraph, trimmed)
+	}
+}
+
+func (r *renderer) heading(level int, title string) {
+	if level < 2 {
+		level = 2
+	}
+	body := r.inline(title)
+	plain := strings.TrimSpace(html.UnescapeString(anyTagRE.ReplaceAllString(body, "")))
+	anchor := strings.ReplaceAll(plain, " ", "_")
+	// repeated headings get numbered ids like MediaWiki does
+	if n := r.anchors[anchor]; n > 0 {
+		r.anchors[anchor]++
+		anchor = fmt.Sprintf("%s_%d", anchor, n+1)
+	} else {
+		r.anchors[anchor] = 1
+	}
+	r.sections = append(r.sections, Section{Level: level, Title: plain, Anchor: anchor})
+	fmt.Fprintf(&r.b, "<h%d id=\"%s\">%s</h%d>\n", level, html.EscapeString(anchor), body, level)
+}
+
+func (r *renderer) closeBlocks() {
+	r.closeParagraph()
+	r.closeLists()
+}
+
+func (r *renderer) closeParagraph() {
+	if len(r.paragraph) == 0 {
+		return
+	}
+	// a paragraph of only category links renders to nothing
+	if text := strings.TrimSpace(r.inline(strings.Join(r.paragraph, " "))); text != "" {
+		r.b.WriteString("<p>")
+		r.b.WriteString(text)
+		r.b.WriteString("</p>\n")
+	}
+	r.paragraph = r.paragraph[:0]
+}
+
+func listTags(marker byte) (list, item string) {
+	switch marker {
+	case '#':
+		return "ol", "li"
+	case ';':
+		return "dl", "dt"
+	case ':':
+		return "dl", "dd"
+	default:
+		return "ul", "li"
+	}
+}
+
+// sameList is whether two markers continue the same kind of list, a ; term
+// and its : definitions share one <dl>.
+func sameList(a, b byte) bool {
+	la, _ := listTags(a)
+	lb, _ := listTags(b)
+	return la == lb
+}
+
+func (r *renderer) listItem(line string) {
+	n := 0
+	for n < len(line) && strings.IndexByte("*#:;", line[n]) >= 0 {
+		n++
+	}
+	markers, content := line[:n], strings.TrimSpace(line[n:])
+
+	// keep the lists both lines share, close the rest and open the new ones
+	common := 0
+	for common < len(markers) && common < len(r.lists) && sameList(markers[common], r.lists[common]) {
+		common++
+	}
+	for len(r.lists) > common {
+		list, item := listTags(r.lists[len(r.lists)-1])
+		fmt.Fprintf(&r.b, "</%s></%s>\n", item, list)
+		r.lists = r.lists[:len(r.lists)-1]
+	}
+	last := len(markers) - 1
+	if len(r.lists) == len(markers) {
+		// another item of the innermost list
+		_, prevItem := listTags(r.lists[last])
+		_, item := listTags(markers[last])
+		fmt.Fprintf(&r.b, "</%s>\n<%s>", prevItem, item)
+		r.lists = r.lists[:last] + markers[last:]
+	}
+	for len(r.lists) < len(markers) {
+		list, item := listTags(markers[len(r.lists)])
+		fmt.Fprintf(&r.b, "<%s><%s>", list, item)
+		r.lists += markers[len(r.lists) : len(r.lists)+1]
+	}
+	// "; term : definition" on one line
+	if markers[last] == ';' {
+		if term, def, ok := strings.Cut(content, " : "); ok {
+			fmt.Fprintf(&r.b, "%s</dt><dd>%s", r.inline(term), r.inline(def))
+			r.lists = r.lists[:last] + ":"
+			return
+		}
+	}
+	r.b.WriteString(r.inline(content))
+}
+
+func (r *renderer) closeLists() {
+	for len(r.lists) > 0 {
+		list, item := listTags(r.lists[len(r.lists)-1])
+		fmt.Fprintf(&r.b, "</%s></%s>\n", item, list)
+		r.lists = r.lists[:len(r.lists)-1]
+	}
+}
+
+func (r *renderer) tableLine(line string) {
+	switch {
+	case strings.HasPrefix(line, "{|"):
+		if r.table {
+			// nested tables are flattened into the outer one
+			return
+		}
+		r.closeBlocks()
+		r.table = true
+		r.b.WriteString("<table class=\"wikitable\">\n")
+	case strings.HasPrefix(line, "|}"):
+		r.closeTable()
+	case strings.HasPrefix(line, "|+"):
+		fmt.Fprintf(&r.b, "<caption>%s</caption>\n", r.inline(cellContent(line[2:])))
+	case strings.HasPrefix(line, "|-"):
+		r.closeRow()
+		r.row = []string{}
+	case strings.HasPrefix(line, "!"):
+		for _, cell := range strings.Split(line[1:], "!!") {
+			r.row = append(r.row, "<th>"+r.inline(cellContent(cell))+"</th>")
+		}
+	case strings.HasPrefix(line, "|"):
+		for _, cell := range strings.Split(line[1:], "||") {
+			r.row = append(r.row, "<td>"+r.inline(cellContent(cell))+"</td>")
+		}
+	case line != "" && len(r.row) > 0:
+		// a cell's content carried onto the next line
+		last := r.row[len(r.row)-1]
+		r.row[len(r.row)-1] = last[:len(last)-5] + " " + r.inline(line) + last[len(last)-5:]
+	}
+}
+
+func (r *renderer) closeTable() {
+	if !r.table {
+		return
+	}
+	r.closeRow()
+	r.table = false
+	r.b.WriteString("</table>\n")
+}
+
+func (r *renderer) closeRow() {
+	if len(r.row) == 0 {
+		return
+	}
+	r.b.WriteString("<tr>")
+	for _, cell := range r.row {
+		r.b.WriteString(cell)
+	}
+	r.b.WriteString("</tr>\n")
+	r.row = nil
+}
+
+// cellContent drops a table cell's attributes, written as "attrs | content".
+func cellContent(cell string) string {
+	parts := splitTopLevel(cell, '|')
+	if len(parts) > 1 && strings.Contains(parts[0], "=") {
+		return strings.Join(parts[1:], "|")
+	}
+	return cell
+}
+
+// inline renders links, bold and italics and escapes everything else.
+func (r *renderer) inline(s string) string {
+	var b strings.Builder
+	var em emphasis
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case strings.HasPrefix(rest, "[["):
+			end := linkEnd(s, i)
+			if end < 0 {
+				b.WriteString(html.EscapeString(rest[:2]))
+				i += 2
+				continue
+			}
+			// a word stuck to the link, [[plant]]s, is part of its label
+			trail := end
+			for trail < len(s) && isLetter(s[trail]) {
+				trail++
+			}
+			b.WriteString(r.internalLink(s[i+2:end-2], s[end:trail]))
+			i = trail
+		case strings.HasPrefix(rest, "[http://") || strings.HasPrefix(rest, "[https://") ||
+			strings.HasPrefix(rest, "[//"):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				b.WriteString("[")
+				i++
+				continue
+			}
+			url, label, _ := strings.Cut(rest[1:end], " ")
+			if label == "" {
+				label = url
+			}
+			fmt.Fprintf(&b, `<a class="external" href="%s">%s</a>`, html.EscapeString(url), r.inline(label))
+			i += end + 1
+		case strings.HasPrefix(rest, "'''''"):
+			// whatever is open closes first, so '''''both''''' nests
+			first, second := "b", "i"
+			if len(em) > 0 && em[len(em)-1] == "i" {
+				first, second = "i", "b"
+			}
+			b.WriteString(em.toggle(first) + em.toggle(second))
+			i += 5
+		case strings.HasPrefix(rest, "'''"):
+			b.WriteString(em.toggle("b"))
+			i += 3
+		case strings.HasPrefix(rest, "''"):
+			b.WriteString(em.toggle("i"))
+			i += 2
+		case rest[0] == '<' && htmlTagRE.MatchString(rest):
+			m := htmlTagRE.FindStringSubmatch(rest)
+			tag := strings.ToLower(m[1])
+			if _, ok := keptTags[tag]; ok {
+				switch {
+				case tag == "br":
+					b.WriteString("<br>")
+				case strings.HasPrefix(m[0], "</"):
+					fmt.Fprintf(&b, "</%s>", tag)
+				default:
+					fmt.Fprintf(&b, "<%s>", tag)
+				}
+			}
+			i += len(m[0])
+		case rest[0] == '&' && entityRE.MatchString(rest):
+			m := entityRE.FindString(rest)
+			b.WriteString(m)
+			i += len(m)
+		default:
+			b.WriteString(html.EscapeString(rest[:1]))
+			i++
+		}
+	}
+	for len(em) > 0 {
+		b.WriteString(em.toggle(em[len(em)-1]))
+	}
+	return b.String()
+}
+
+// emphasis is the open bold and italic tags, innermost last.
+type emphasis []string
+
+// toggle opens the tag or closes it. Tags opened inside it are closed first
+// and opened again after, wikitext lets bold and italics overlap but HTML
+// doesn't.
+func (em *emphasis) toggle(tag string) string {
+	i := slices.Index(*em, tag)
+	if i < 0 {
+		*em = append(*em, tag)
+		return "<" + tag + ">"
+	}
+	inner := slices.Clone((*em)[i+1:])
+	var b strings.Builder
+	for _, t := range slices.Backward(inner) {
+		b.WriteString("</" + t + ">")
+	}
+	b.WriteString("</" + tag + ">")
+	for _, t := range inner {
+		b.WriteString("<" + t + ">")
+	}
+	*em = append((*em)[:i], inner...)
+	return b.String()
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+// linkEnd is the offset just past the ]] closing the link opened at start,
+// or -1 when it isn't closed. File links can have links in their captions.
+func linkEnd(s string, start int) int {
+	depth := 0
+	for i := start; i+1 < len(s); i++ {
+		switch {
+		case s[i] == '[' && s[i+1] == '[':
+			depth++
+			i++
+		case s[i] == ']' && s[i+1] == ']':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+func (r *renderer) internalLink(inner, trail string) string {
+	target, label, hasLabel := strings.Cut(inner, "|")
+	target = strings.TrimSpace(target)
+	lower := strings.ToLower(target)
+	if name, ok := strings.CutPrefix(lower, "category:"); ok {
+		name = strings.TrimSpace(target[len(target)-len(name):])
+		if name != "" && !slices.Contains(r.categories, name) {
+			r.categories = append(r.categories, name)
+		}
+	}
+	for _, ns := range droppedNamespaces {
+		if strings.HasPrefix(lower, ns) {
+			return ""
+		}
+	}
+	// [[:Category:Foo]] links to the category rather than adding the page
+	target = strings.TrimPrefix(target, ":")
+	if !hasLabel {
+		label = target
+	} else if label == "" {
+		// the pipe trick, [[Paris, Texas|]] shows "Paris"
+		label, _, _ = strings.Cut(target, ",")
+		label, _, _ = strings.Cut(label, " (")
+	}
+	page, anchor, _ := strings.Cut(target, "#")
+	href := "#" + strings.ReplaceAll(anchor, " ", "_")
+	if page != "" {
+		href = r.link(page)
+		if anchor != "" {
+			href += "#" + strings.ReplaceAll(anchor, " ", "_")
+		}
+	}
+	return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), r.inline(label+trail))
+}
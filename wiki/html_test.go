@@ -0,0 +1,77 @@
+package wiki
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testLink(title string) string { return "/wiki/" + title }
+
+func TestRenderHTML(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"paragraphs", "First line\nsame paragraph.\n\nSecond.",
+			"<p>First line same paragraph.</p>\n<p>Second.</p>\n"},
+		{"bold and italics", "Plants are '''green''' and ''alive''.",
+			"<p>Plants are <b>green</b> and <i>alive</i>.</p>\n"},
+		{"bold italics", "'''''both''''' and '''''more''' italic''",
+			"<p><b><i>both</i></b> and <b><i>more</i></b><i> italic</i></p>\n"},
+		{"overlapping", "'''bold ''both''' italic''",
+			"<p><b>bold <i>both</i></b><i> italic</i></p>\n"},
+		{"unclosed", "'''bold ''both",
+			"<p><b>bold <i>both</i></b></p>\n"},
+		{"lists", "* one\n* two\n** two a\n# first\n# second",
+			"<ul><li>one</li>\n<li>two<ul><li>two a</li></ul>\n</li></ul>\n<ol><li>first</li>\n<li>second</li></ol>\n"},
+		{"definitions", "; term\n: definition",
+			"<dl><dt>term</dt>\n<dd>definition</dd></dl>\n"},
+		{"table", "{| class=\"wikitable\"\n|-\n! Name !! Size\n|-\n| Fern || small\n|-\n| Oak\n| big\n|}",
+			"<table class=\"wikitable\">\n<tr><th> Name </th><th> Size</th></tr>\n<tr><td> Fern </td><td> small</td></tr>\n<tr><td> Oak</td><td> big</td></tr>\n</table>\n"},
+		{"unclosed table", "{|\n|a\n|-\n|b",
+			"<table class=\"wikitable\">\n<tr><td>a</td></tr>\n<tr><td>b</td></tr>\n</table>\n"},
+		{"links", "See [[Fern]] and [[Tree|trees]] or [[moss]]es.",
+			`<p>See <a href="/wiki/Fern">Fern</a> and <a href="/wiki/Tree">trees</a> or <a href="/wiki/moss">mosses</a>.</p>` + "\n"},
+		{"external links", "[https://example.com Example] and [https://example.org]",
+			`<p><a class="external" href="https://example.com">Example</a> and <a class="external" href="https://example.org">https://example.org</a></p>` + "\n"},
+		{"files and categories", "[[File:Plant.jpg|thumb|A [[plant]]]] Text.[[Category:Plants]] [[:Category:Trees]]",
+			`<p>Text. <a href="/wiki/Category:Trees">Category:Trees</a></p>` + "\n"},
+		{"left out", "{{Infobox plant|name=x}}Plants<ref>cite</ref> grow.<!-- hidden --> __NOTOC__<math>x^2</math>",
+			"<p>Plants grow.</p>\n"},
+		{"escaping", `<script>alert(1)</script> a < b & <b onclick="x">bold</b> &amp; &nbsp;<br/>`,
+			"<p>alert(1) a &lt; b &amp; <b>bold</b> &amp; &nbsp;<br></p>\n"},
+		{"rule", "Above\n----\nBelow", "<p>Above</p>\n<hr>\n<p>Below</p>\n"},
+	}
+	for _, tt := range tests {
+		if got := RenderHTML(tt.text, testLink).HTML; got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRenderHTMLSections(t *testing.T) {
+	r := RenderHTML("Intro.\n== Uses ==\nText.\n=== Food & drink ===\nMore.\n== Uses ==\nAgain.\n[[Category:Plants]]\n[[category:Food plants|Fern]]", testLink)
+	wantSections := []Section{
+		{Level: 2, Title: "Uses", Anchor: "Uses"},
+		{Level: 3, Title: "Food & drink", Anchor: "Food_&_drink"},
+		{Level: 2, Title: "Uses", Anchor: "Uses_2"},
+	}
+	if !reflect.DeepEqual(r.Sections, wantSections) {
+		t.Errorf("sections = %+v, want %+v", r.Sections, wantSections)
+	}
+	if want := []string{"Plants", "Food plants"}; !reflect.DeepEqual(r.Categories, want) {
+		t.Errorf("categories = %v, want %v", r.Categories, want)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := map[string]string{
+		"The [[Fern|ferns]] of ''Europe''<ref>x</ref>": "The ferns of Europe",
+		"Fish &amp; chips {{lang|fr|frites}}":          "Fish & chips",
+		"[[London]], <small>England</small>":           "London, England",
+	}
+	for text, want := range tests {
+		if got := PlainText(text); got != want {
+			t.Errorf("PlainText(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
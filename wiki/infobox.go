@@ -0,0 +1,129 @@
+package wiki
+
+import (
+	"strings"
+)
+
+// Infobox is the infobox template of an article, with its fields in the
+// order they're written.
+type Infobox struct {
+	Type   string         `json:"type"` // what follows "Infobox", like "person", may be empty
+	Fields []InfoboxField `json:"fields"`
+}
+
+// InfoboxField is one parameter of an infobox. Value is still wikitext, Text
+// is what it reads as with the markup and templates taken out.
+type InfoboxField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Text  string `json:"text"`
+}
+
+// ParseInfobox finds the first infobox template in the wikitext, returning
+// nil when the article has none. Fields without a value are left out.
+func ParseInfobox(text string) *Infobox {
+	for _, span := range templateSpans(text) {
+		// an unclosed template has no braces to cut off the end
+		inner := strings.TrimSuffix(text[span[0]+2:span[1]], "}}")
+		parts := splitTopLevel(inner, '|')
+		name := strings.TrimSpace(parts[0])
+		typ, ok := cutPrefixFold(name, "infobox")
+		if !ok {
+			continue
+		}
+		ib := &Infobox{Type: strings.TrimSpace(typ)}
+		for _, p := range parts[1:] {
+			key, value, ok := strings.Cut(p, "=")
+			if !ok {
+				continue
+			}
+			key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+			if key == "" || value == "" {
+				continue
+			}
+			ib.Fields = append(ib.Fields, InfoboxField{Name: key, Value: value, Text: PlainText(value)})
+		}
+		return ib
+	}
+	return nil
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+// templateSpans returns the start and end offsets of every top level {{...}}
+// in text, end being just past the closing braces. An unclosed template runs
+// to the end of the text.
+func templateSpans(text string) [][2]int {
+	var spans [][2]int
+	depth, start := 0, 0
+	for i := 0; i < len(text)-1; i++ {
+		switch {
+		case text[i] == '{' && text[i+1] == '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+			i++
+		case text[i] == '}' && text[i+1] == '}' && depth > 0:
+			depth--
+			i++
+			if depth == 0 {
+				spans = append(spans, [2]int{start, i + 1})
+			}
+		}
+	}
+	if depth > 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// StripTemplates removes every template from the wikitext.
+func StripTemplates(text string) string {
+	spans := templateSpans(text)
+	if len(spans) == 0 {
+		return text
+	}
+	var b strings.Builder
+	b.Grow(len(text))
+	last := 0
+	for _, span := range spans {
+		b.WriteString(text[last:span[0]])
+		last = span[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// splitTopLevel splits s on sep where it isn't inside a [[link]] or a
+// {{template}}.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	links, templates, last := 0, 0, 0
+	for i := 0; i < len(s); i++ {
+		two := i+1 < len(s)
+		switch {
+		case two && s[i] == '[' && s[i+1] == '[':
+			links++
+			i++
+		case two && s[i] == ']' && s[i+1] == ']' && links > 0:
+			links--
+			i++
+		case two && s[i] == '{' && s[i+1] == '{':
+			templates++
+			i++
+		case two && s[i] == '}' && s[i+1] == '}' && templates > 0:
+			templates--
+			i++
+		case s[i] == sep && links == 0 && templates == 0:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
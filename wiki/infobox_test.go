@@ -0,0 +1,69 @@
+package wiki
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseInfobox(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want *Infobox
+	}{
+		{"none", "A plain article with a {{citation needed}}.", nil},
+		{
+			"fields in order",
+			"{{Short description|A scientist}}\n{{Infobox scientist\n| name = Marie Curie\n| birth_place = [[Warsaw]], [[Congress Poland|Poland]]\n| spouse = \n| awards = {{plainlist|Nobel Prize}} in Physics\n}}\nMarie Curie was a physicist.",
+			&Infobox{Type: "scientist", Fields: []InfoboxField{
+				{Name: "name", Value: "Marie Curie", Text: "Marie Curie"},
+				{Name: "birth_place", Value: "[[Warsaw]], [[Congress Poland|Poland]]", Text: "Warsaw, Poland"},
+				{Name: "awards", Value: "{{plainlist|Nobel Prize}} in Physics", Text: "in Physics"},
+			}},
+		},
+		{
+			"pipes in links and templates aren't fields",
+			"{{infobox|image = [[File:Rose.jpg|thumb|A rose]]|color={{color|red|Red}}|no value here}}",
+			&Infobox{Fields: []InfoboxField{
+				{Name: "image", Value: "[[File:Rose.jpg|thumb|A rose]]", Text: ""},
+				{Name: "color", Value: "{{color|red|Red}}", Text: ""},
+			}},
+		},
+		{
+			"only the first infobox",
+			"{{Infobox river|name=Nile}}{{Infobox river|name=Congo}}",
+			&Infobox{Type: "river", Fields: []InfoboxField{{Name: "name", Value: "Nile", Text: "Nile"}}},
+		},
+		{
+			"unclosed",
+			"{{Infobox river|name=Nile|length=6650 km",
+			&Infobox{Type: "river", Fields: []InfoboxField{
+				{Name: "name", Value: "Nile", Text: "Nile"},
+				{Name: "length", Value: "6650 km", Text: "6650 km"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseInfobox(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseInfobox = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripTemplates(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"no templates", "no templates"},
+		{"{{Infobox|a={{b|c}}}}Text{{cite}} and more.", "Text and more."},
+		{"Before {{unclosed|{{nested}}", "Before "},
+		{"Single {braces} stay}}", "Single {braces} stay}}"},
+	}
+	for _, tt := range tests {
+		if got := StripTemplates(tt.text); got != tt.want {
+			t.Errorf("StripTemplates(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
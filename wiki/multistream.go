@@ -0,0 +1,42 @@
+package wiki
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ReadMultistreamIndex parses a multistream index file, where each line looks
+// like "offset:pageID:title", and returns the distinct bz2 stream offsets in
+// ascending order. Each stream can be decompressed on its own.
+func ReadMultistreamIndex(r io.Reader) ([]int64, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	offsets := make([]int64, 0, 1024)
+	var last int64 = -1
+	for s.Scan() {
+		line := s.Text()
+		offsetStr, _, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed multistream index line: %q", line)
+		}
+		offset, err := strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing stream offset %q: %w", offsetStr, err)
+		}
+		// the ~100 pages of a stream are listed together, skip the repeats
+		if offset == last {
+			continue
+		}
+		offsets = append(offsets, offset)
+		last = offset
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed scanning the multistream index: %w", err)
+	}
+	slices.Sort(offsets)
+	return slices.Compact(offsets), nil
+}
@@ -0,0 +1,30 @@
+package wiki
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadMultistreamIndex(t *testing.T) {
+	offsets, err := ReadMultistreamIndex(strings.NewReader(`597:10:AccessibleComputing
+597:12:Anarchism
+597:13:AfghanistanHistory
+2011:1000:Title: with colons
+1500:900:Out of order
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{597, 1500, 2011}; !slices.Equal(offsets, want) {
+		t.Errorf("offsets = %v, want %v", offsets, want)
+	}
+	if offsets, err := ReadMultistreamIndex(strings.NewReader("")); err != nil || len(offsets) != 0 {
+		t.Errorf("empty index = %v, %v", offsets, err)
+	}
+	for _, index := range []string{"597 10 Anarchism\n", "x:10:Anarchism\n"} {
+		if _, err := ReadMultistreamIndex(strings.NewReader(index)); err == nil {
+			t.Errorf("ReadMultistreamIndex(%q) succeeded", index)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package wiki
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// PageID pulls the page ID out of a raw <page> element without decoding the
+// rest of it. The first <id> in a page is always the page's, the revision and
+// contributor IDs come after it.
+func PageID(pageBuffer []byte) (int64, error) {
+	_, rest, ok := bytes.Cut(pageBuffer, []byte("<id>"))
+	if !ok {
+		return 0, fmt.Errorf("page has no id element")
+	}
+	idBytes, _, ok := bytes.Cut(rest, []byte("</id>"))
+	if !ok {
+		return 0, fmt.Errorf("page has an unterminated id element")
+	}
+	id, err := strconv.ParseInt(string(bytes.TrimSpace(idBytes)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed parsing page id: %w", err)
+	}
+	return id, nil
+}
+
+// LastRevision drops every revision of a raw <page> element but the last.
+// History dumps, like the incremental ones, have all of a page's revisions in
+// the order they were made. Revision text is escaped, so the tag can't be part
+// of it.
+func LastRevision(pageBuffer []byte) []byte {
+	open := []byte("<revision>")
+	first := bytes.Index(pageBuffer, open)
+	last := bytes.LastIndex(pageBuffer, open)
+	if first < 0 || first == last {
+		return pageBuffer
+	}
+	trimmed := make([]byte, 0, first+len(pageBuffer)-last)
+	trimmed = append(trimmed, pageBuffer[:first]...)
+	return append(trimmed, pageBuffer[last:]...)
+}
@@ -0,0 +1,45 @@
+package wiki
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPageID(t *testing.T) {
+	tests := []struct {
+		page string
+		want int64
+		ok   bool
+	}{
+		{"<page>\n<title>Fern</title>\n<id> 12 </id>\n<revision>\n<id>34</id>\n</revision>\n</page>", 12, true},
+		{"<page>\n<title>Fern</title>\n</page>", 0, false},
+		{"<page>\n<id>12", 0, false},
+		{"<page>\n<id>twelve</id>\n</page>", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := PageID([]byte(tt.page))
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("PageID(%q) = %d, %v, want %d", tt.page, got, err, tt.want)
+		}
+	}
+}
+
+func TestLastRevision(t *testing.T) {
+	const page = "<page>\n<title>Fern</title>\n<id>12</id>\n"
+	revision := func(id int) string {
+		// escaped like dump text, so the tag can't be mistaken for one
+		return fmt.Sprintf("<revision>\n<id>%d</id>\n<text>&lt;revision&gt; %d</text>\n</revision>\n", id, id)
+	}
+	tests := []struct {
+		name, page, want string
+	}{
+		{"one revision", page + revision(1) + "</page>\n", page + revision(1) + "</page>\n"},
+		{"history", page + revision(1) + revision(2) + revision(3) + "</page>\n", page + revision(3) + "</page>\n"},
+		{"no revision", page + "</page>\n", page + "</page>\n"},
+	}
+	for _, tt := range tests {
+		if got := string(LastRevision([]byte(tt.page))); got != tt.want {
+			t.Errorf("%s: LastRevision = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
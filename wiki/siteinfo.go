@@ -1,6 +1,13 @@
 package wiki
 
-import "encoding/xml"
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
 
 // Siteinfo was generated 2024-09-08 14:09:30 by https://xml-to-go.github.io/ in Ukraine.
 type Siteinfo struct {
@@ -20,3 +27,36 @@ type Siteinfo struct {
 		} `xml:"namespace"`
 	} `xml:"namespaces"`
 }
+
+// ReadSiteinfo reads the <siteinfo> element at the start of a dump, before
+// any of the pages.
+func ReadSiteinfo(r io.Reader) (Siteinfo, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	section := false
+	buf := make([]byte, 0, 64*1024)
+	for s.Scan() {
+		line := s.Bytes()
+		if bytes.Contains(line, []byte("<siteinfo>")) {
+			section = true
+		}
+		if section {
+			buf = append(buf, line...)
+			buf = append(buf, '\n')
+		}
+		if bytes.Contains(line, []byte("</siteinfo>")) {
+			var si Siteinfo
+			if err := xml.Unmarshal(buf, &si); err != nil {
+				return Siteinfo{}, fmt.Errorf("failed to unmarshal siteinfo: %w", err)
+			}
+			return si, nil
+		}
+		if bytes.Contains(line, []byte("<page>")) {
+			break
+		}
+	}
+	if err := s.Err(); err != nil {
+		return Siteinfo{}, fmt.Errorf("failed to scan for siteinfo: %w", err)
+	}
+	return Siteinfo{}, errors.New("dump has no siteinfo")
+}
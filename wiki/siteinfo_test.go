@@ -0,0 +1,47 @@
+package wiki
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSiteinfo = `<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.11/" version="0.11" xml:lang="en">
+  <siteinfo>
+    <sitename>Wikipedia</sitename>
+    <dbname>enwiki</dbname>
+    <base>https://en.wikipedia.org/wiki/Main_Page</base>
+    <generator>MediaWiki 1.43.0-wmf.20</generator>
+    <case>first-letter</case>
+    <namespaces>
+      <namespace key="-1" case="first-letter">Special</namespace>
+      <namespace key="0" case="first-letter" />
+      <namespace key="14" case="first-letter">Category</namespace>
+    </namespaces>
+  </siteinfo>
+`
+
+func TestReadSiteinfo(t *testing.T) {
+	si, err := ReadSiteinfo(strings.NewReader(testSiteinfo + "  <page>\n    <title>Fern</title>\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si.Sitename != "Wikipedia" || si.Dbname != "enwiki" || si.Base != "https://en.wikipedia.org/wiki/Main_Page" ||
+		si.Generator != "MediaWiki 1.43.0-wmf.20" || si.Case != "first-letter" {
+		t.Errorf("siteinfo = %+v", si)
+	}
+	namespaces := si.Namespaces.Namespace
+	if len(namespaces) != 3 || namespaces[1].Key != "0" || namespaces[1].Text != "" ||
+		namespaces[2].Key != "14" || namespaces[2].Text != "Category" || namespaces[2].Case != "first-letter" {
+		t.Errorf("namespaces = %+v", namespaces)
+	}
+
+	for name, dump := range map[string]string{
+		"no siteinfo":       "<mediawiki>\n  <page>\n    <title>Fern</title>\n  </page>\n</mediawiki>\n",
+		"unclosed siteinfo": strings.TrimSuffix(testSiteinfo, "  </siteinfo>\n"),
+		"empty":             "",
+	} {
+		if _, err := ReadSiteinfo(strings.NewReader(dump)); err == nil {
+			t.Errorf("ReadSiteinfo of a dump with %s succeeded", name)
+		}
+	}
+}